@@ -95,6 +95,7 @@ var QuotaForInvitee int64 = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+var AdaptiveBalancingEnabled = false
 var QuotaRemindThreshold int64 = 1000
 var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
@@ -150,6 +151,22 @@ var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.
 var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
+var CircuitBreakerEnabled = env.Bool("CIRCUIT_BREAKER_ENABLED", false)
+var CircuitBreakerFailureThreshold = env.Int("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5)
+var CircuitBreakerCooldown = env.Int("CIRCUIT_BREAKER_COOLDOWN", 30) // unit is second
+var CircuitBreakerHalfOpenRequests = env.Int("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", 1)
+
+// StickyRoutingKey lists where the affinity key of a request comes from, the first source the request
+// has is used: session (the X-Session-Id header), user (the user field), messages (the first
+// STICKY_ROUTING_MESSAGES messages) and token
+var StickyRoutingKey = env.String("STICKY_ROUTING_KEY", "")
+var StickyRoutingMessages = env.Int("STICKY_ROUTING_MESSAGES", 2)
+
+// HedgeGroups are the groups whose non-streaming requests are hedged, tokens may opt in on their own
+var HedgeGroups []string
+var HedgePercentile = env.Float64("HEDGE_PERCENTILE", 95)
+var HedgeDefaultDelay = env.Int("HEDGE_DEFAULT_DELAY", 3000) // unit is millisecond
+
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
 var InitialRootAccessToken = os.Getenv("INITIAL_ROOT_ACCESS_TOKEN")
@@ -164,3 +181,11 @@ var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
 
 var EnforceIncludeUsage = env.Bool("ENFORCE_INCLUDE_USAGE", false)
 var TestPrompt = env.String("TEST_PROMPT", "Output only your specific model name with no additional text.")
+
+var FileStorageDir = env.String("FILE_STORAGE_DIR", "./files")
+var MaxFileSize = env.Int("MAX_FILE_SIZE", 200)                  // unit is MB
+var BatchWorkerFrequency = env.Int("BATCH_WORKER_FREQUENCY", 10) // unit is second
+var BatchConcurrency = env.Int("BATCH_CONCURRENCY", 4)
+
+var VideoTaskWorkerFrequency = env.Int("VIDEO_TASK_WORKER_FREQUENCY", 10) // unit is second
+var VideoTaskTimeout = env.Int("VIDEO_TASK_TIMEOUT", 2*60*60)             // unit is second
@@ -8,17 +8,31 @@ const (
 	Status            = "status"
 	Channel           = "channel"
 	ChannelId         = "channel_id"
+	ChannelSlot       = "channel_slot"
 	SpecificChannelId = "specific_channel_id"
 	RequestModel      = "request_model"
 	ConvertedRequest  = "converted_request"
 	OriginalModel     = "original_model"
+	FallbackModel     = "fallback_model"
+	ModelAlias        = "model_alias"
 	Group             = "group"
 	ModelMapping      = "model_mapping"
 	ChannelName       = "channel_name"
+	ChannelKey        = "channel_key"
+	Affinity          = "affinity"
 	TokenId           = "token_id"
 	TokenName         = "token_name"
 	BaseURL           = "base_url"
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
 	SystemPrompt      = "system_prompt"
+	Usage             = "usage"
+	UpstreamHeader    = "upstream_header"
+	UpstreamError     = "upstream_error"
+	Hedge             = "hedge"
+	HedgeClaim        = "hedge_claim"
+	Hedged            = "hedged"
+	UpstreamContext   = "upstream_context"
+	PromptTokens      = "prompt_tokens"
+	MaxContext        = "max_context"
 )
@@ -2,4 +2,5 @@ package helper
 
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
+	ModelKey     = "X-Oneapi-Model"
 )
@@ -55,6 +55,23 @@ func GetRandomNumberString(length int) string {
 	return string(key)
 }
 
+// WeightedIndex returns a random index of weights with a probability proportional to its weight,
+// a weight of 0 counts as 1 so that all-zero weights are picked uniformly.
+func WeightedIndex(weights []uint) int {
+	total := 0
+	for _, weight := range weights {
+		total += int(max(weight, 1))
+	}
+	n := rand.Intn(total)
+	for i, weight := range weights {
+		n -= int(max(weight, 1))
+		if n < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
 // RandRange returns a random number between min and max (max is not included)
 func RandRange(min, max int) int {
 	return min + rand.Intn(max-min)
@@ -0,0 +1,416 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// The batch worker runs on the master node. Every line of a batch is served by an in-process
+// engine with the same middlewares as the relay router, so channel selection, quota and logs
+// work exactly as for a normal request made with the token that created the batch.
+
+var batchEngine *gin.Engine
+var runningBatches sync.Map
+var batchSignal = make(chan struct{}, 1)
+
+func notifyBatchWorker() {
+	select {
+	case batchSignal <- struct{}{}:
+	default:
+	}
+}
+
+func newBatchEngine() *gin.Engine {
+	engine := gin.New()
+	engine.Use(gin.Recovery(), middleware.RequestId())
+	relayRouter := engine.Group("/v1")
+	relayRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+	for _, endpoint := range batchEndpoints {
+		relayRouter.POST(strings.TrimPrefix(endpoint, "/v1"), Relay)
+	}
+	return engine
+}
+
+func AutomaticallyRunBatches(frequency int) {
+	batchEngine = newBatchEngine()
+	for {
+		batches, err := dbmodel.GetUnfinishedBatches()
+		if err != nil {
+			logger.SysError("failed to get unfinished batches: " + err.Error())
+		}
+		for _, batch := range batches {
+			if _, running := runningBatches.LoadOrStore(batch.Id, true); running {
+				continue
+			}
+			go func(id string) {
+				defer runningBatches.Delete(id)
+				runBatch(id)
+			}(batch.Id)
+		}
+		select {
+		case <-batchSignal:
+		case <-time.After(time.Duration(frequency) * time.Second):
+		}
+	}
+}
+
+func runBatch(id string) {
+	for {
+		batch, err := dbmodel.GetBatchById(id)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to get batch %s: %s", id, err.Error()))
+			return
+		}
+		switch batch.Status {
+		case dbmodel.BatchStatusValidating:
+			err = validateBatch(batch)
+		case dbmodel.BatchStatusInProgress:
+			err = processBatch(batch)
+		case dbmodel.BatchStatusCancelling:
+			err = finishBatch(batch, []string{dbmodel.BatchStatusCancelling}, dbmodel.BatchStatusCancelled)
+		default:
+			return
+		}
+		if err != nil {
+			// left for the next round of the worker
+			logger.SysError(fmt.Sprintf("failed to run batch %s: %s", id, err.Error()))
+			return
+		}
+	}
+}
+
+func readBatchLines(batch *dbmodel.Batch) ([]openai.BatchInputLine, []openai.BatchError) {
+	file, err := os.Open(dbmodel.GetFilePath(batch.InputFileId))
+	if err != nil {
+		return nil, []openai.BatchError{{Code: "invalid_file", Message: "failed to read the input file"}}
+	}
+	defer file.Close()
+	var lines []openai.BatchInputLine
+	var batchErrors []openai.BatchError
+	customIds := make(map[string]bool)
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, []openai.BatchError{{Code: "invalid_file", Message: err.Error()}}
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			line := openai.BatchInputLine{}
+			message := ""
+			if e := json.Unmarshal(data, &line); e != nil {
+				message = "invalid json: " + e.Error()
+			} else if line.CustomId == "" {
+				message = "custom_id is required"
+			} else if customIds[line.CustomId] {
+				message = "duplicate custom_id: " + line.CustomId
+			} else if line.Method != http.MethodPost {
+				message = "method must be POST"
+			} else if line.Url != batch.Endpoint {
+				message = fmt.Sprintf("url must be %s", batch.Endpoint)
+			} else if isStreamRequest(line.Body) {
+				message = "stream is not supported in batches"
+			}
+			if message != "" {
+				n := lineNumber
+				batchErrors = append(batchErrors, openai.BatchError{Code: "invalid_request", Message: message, Line: &n})
+			} else {
+				customIds[line.CustomId] = true
+				lines = append(lines, line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(lines) == 0 && len(batchErrors) == 0 {
+		batchErrors = append(batchErrors, openai.BatchError{Code: "empty_file", Message: "the input file is empty"})
+	}
+	return lines, batchErrors
+}
+
+func isStreamRequest(body json.RawMessage) bool {
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+	_ = json.Unmarshal(body, &request)
+	return request.Stream
+}
+
+func isBatchExpired(batch *dbmodel.Batch) bool {
+	return batch.ExpiresAt != 0 && helper.GetTimestamp() >= batch.ExpiresAt
+}
+
+func validateBatch(batch *dbmodel.Batch) error {
+	if isBatchExpired(batch) {
+		return finishBatch(batch, []string{dbmodel.BatchStatusValidating}, dbmodel.BatchStatusExpired)
+	}
+	now := helper.GetTimestamp()
+	lines, batchErrors := readBatchLines(batch)
+	if len(batchErrors) > 0 {
+		errorsJson, _ := json.Marshal(batchErrors)
+		_, err := dbmodel.UpdateBatchStatus(batch.Id, []string{dbmodel.BatchStatusValidating}, dbmodel.BatchStatusFailed, map[string]any{
+			"errors":    string(errorsJson),
+			"failed_at": now,
+		})
+		return err
+	}
+	_, err := dbmodel.UpdateBatchStatus(batch.Id, []string{dbmodel.BatchStatusValidating}, dbmodel.BatchStatusInProgress, map[string]any{
+		"total_count":    len(lines),
+		"in_progress_at": now,
+	})
+	return err
+}
+
+func batchOutputPath(batch *dbmodel.Batch, kind string) string {
+	return dbmodel.GetFilePath(fmt.Sprintf("%s_%s.jsonl", batch.Id, kind))
+}
+
+// readFinishedLines collects the custom ids of the lines written to an output file of the batch
+// and returns how many there are. A line cut off by a crash is removed, it is executed again.
+func readFinishedLines(path string, finished map[string]bool) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	count := 0
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		line := openai.BatchOutputLine{}
+		if err == io.EOF || json.Unmarshal(data, &line) != nil || line.CustomId == "" {
+			break
+		}
+		finished[line.CustomId] = true
+		count++
+		offset += int64(len(data))
+	}
+	return count, file.Truncate(offset)
+}
+
+func writeBatchLine(file *os.File, result openai.BatchOutputLine) error {
+	data, _ := json.Marshal(result)
+	_, err := file.Write(append(data, '\n'))
+	return err
+}
+
+func processBatch(batch *dbmodel.Batch) error {
+	lines, batchErrors := readBatchLines(batch)
+	if len(batchErrors) > 0 {
+		// the input file has been deleted or changed since validation
+		errorsJson, _ := json.Marshal(batchErrors)
+		_, err := dbmodel.UpdateBatchStatus(batch.Id, []string{dbmodel.BatchStatusInProgress}, dbmodel.BatchStatusFailed, map[string]any{
+			"errors":    string(errorsJson),
+			"failed_at": helper.GetTimestamp(),
+		})
+		return err
+	}
+	key := ""
+	if token, err := dbmodel.GetTokenById(batch.TokenId); err == nil {
+		key = token.Key
+	}
+	// the output files are the record of the finished lines, so that a line written before a
+	// restart is neither executed nor billed again
+	finished := make(map[string]bool)
+	completedCount, err := readFinishedLines(batchOutputPath(batch, "output"), finished)
+	if err != nil {
+		return err
+	}
+	failedCount, err := readFinishedLines(batchOutputPath(batch, "error"), finished)
+	if err != nil {
+		return err
+	}
+	outputFile, err := os.OpenFile(batchOutputPath(batch, "output"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+	errorFile, err := os.OpenFile(batchOutputPath(batch, "error"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer errorFile.Close()
+
+	concurrency := config.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var pending []openai.BatchInputLine
+	for _, line := range lines {
+		if !finished[line.CustomId] {
+			pending = append(pending, line)
+		}
+	}
+	if completedCount != batch.CompletedCount || failedCount != batch.FailedCount {
+		err = dbmodel.UpdateBatchProgress(batch.Id, completedCount, failedCount)
+		if err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(pending); start += concurrency {
+		current, err := dbmodel.GetBatchById(batch.Id)
+		if err != nil {
+			return err
+		}
+		if current.Status != dbmodel.BatchStatusInProgress {
+			return nil
+		}
+		if isBatchExpired(current) {
+			for _, line := range pending[start:] {
+				err = writeBatchLine(errorFile, openai.BatchOutputLine{
+					Id:       "batch_req_" + random.GetUUID(),
+					CustomId: line.CustomId,
+					Error:    &openai.BatchError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+				})
+				if err != nil {
+					return err
+				}
+				failedCount++
+			}
+			err = dbmodel.UpdateBatchProgress(batch.Id, completedCount, failedCount)
+			if err != nil {
+				return err
+			}
+			return finishBatch(batch, []string{dbmodel.BatchStatusInProgress}, dbmodel.BatchStatusExpired)
+		}
+		chunk := pending[start:min(start+concurrency, len(pending))]
+		results := make([]openai.BatchOutputLine, len(chunk))
+		var wg sync.WaitGroup
+		for i := range chunk {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = executeBatchLine(key, chunk[i])
+			}(i)
+		}
+		wg.Wait()
+		for _, result := range results {
+			if result.Response.StatusCode == http.StatusOK {
+				err = writeBatchLine(outputFile, result)
+				completedCount++
+			} else {
+				err = writeBatchLine(errorFile, result)
+				failedCount++
+			}
+			if err != nil {
+				return err
+			}
+		}
+		err = dbmodel.UpdateBatchProgress(batch.Id, completedCount, failedCount)
+		if err != nil {
+			return err
+		}
+	}
+	return finishBatch(batch, []string{dbmodel.BatchStatusInProgress}, dbmodel.BatchStatusCompleted)
+}
+
+func executeBatchLine(key string, line openai.BatchInputLine) openai.BatchOutputLine {
+	req, _ := http.NewRequest(http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.RemoteAddr = "127.0.0.1:0"
+	recorder := httptest.NewRecorder()
+	batchEngine.ServeHTTP(recorder, req)
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	return openai.BatchOutputLine{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: line.CustomId,
+		Response: &openai.BatchOutputResponse{
+			StatusCode: recorder.Code,
+			RequestId:  recorder.Header().Get(helper.RequestIdKey),
+			Body:       body,
+		},
+	}
+}
+
+// saveBatchOutput turns a non-empty output of the batch into a downloadable file.
+func saveBatchOutput(batch *dbmodel.Batch, kind string) (string, error) {
+	path := batchOutputPath(batch, kind)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", os.Remove(path)
+	}
+	file := &dbmodel.File{
+		Id:        "file-" + random.GetUUID(),
+		UserId:    batch.UserId,
+		Bytes:     info.Size(),
+		Filename:  fmt.Sprintf("%s_%s.jsonl", batch.Id, kind),
+		Purpose:   dbmodel.FilePurposeBatchOutput,
+		CreatedAt: helper.GetTimestamp(),
+	}
+	err = os.Rename(path, file.Path())
+	if err != nil {
+		return "", err
+	}
+	return file.Id, file.Insert()
+}
+
+func finishBatch(batch *dbmodel.Batch, from []string, status string) error {
+	outputFileId, err := saveBatchOutput(batch, "output")
+	if err != nil {
+		return err
+	}
+	errorFileId, err := saveBatchOutput(batch, "error")
+	if err != nil {
+		return err
+	}
+	fields := map[string]any{
+		"output_file_id": outputFileId,
+		"error_file_id":  errorFileId,
+	}
+	now := helper.GetTimestamp()
+	switch status {
+	case dbmodel.BatchStatusCancelled:
+		fields["cancelled_at"] = now
+	case dbmodel.BatchStatusExpired:
+		fields["expired_at"] = now
+	default:
+		fields["completed_at"] = now
+	}
+	ok, err := dbmodel.UpdateBatchStatus(batch.Id, from, status, fields)
+	if err != nil || ok || status == dbmodel.BatchStatusCancelled {
+		return err
+	}
+	// the batch was cancelled meanwhile, its outputs have been saved already
+	delete(fields, "completed_at")
+	delete(fields, "expired_at")
+	fields["cancelled_at"] = now
+	_, err = dbmodel.UpdateBatchStatus(batch.Id, []string{dbmodel.BatchStatusCancelling}, dbmodel.BatchStatusCancelled, fields)
+	return err
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+var batchEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+}
+
+func isBatchEndpoint(endpoint string) bool {
+	for _, e := range batchEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func optionalTimestamp(timestamp int64) *int64 {
+	if timestamp == 0 {
+		return nil
+	}
+	return &timestamp
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func batchObject(batch *dbmodel.Batch) openai.Batch {
+	object := openai.Batch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: openai.BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		object.Errors = &openai.BatchErrors{Object: "list"}
+		_ = json.Unmarshal([]byte(batch.Errors), &object.Errors.Data)
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &object.Metadata)
+	}
+	return object
+}
+
+func CreateBatch(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	batchRequest := openai.BatchRequest{}
+	err := common.UnmarshalBodyReusable(c, &batchRequest)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	if !isBatchEndpoint(batchRequest.Endpoint) {
+		abortWithOpenAIError(c, http.StatusBadRequest, fmt.Errorf("unsupported endpoint: %s", batchRequest.Endpoint))
+		return
+	}
+	if batchRequest.CompletionWindow != "24h" {
+		abortWithOpenAIError(c, http.StatusBadRequest, errors.New("completion_window must be 24h"))
+		return
+	}
+	file, err := dbmodel.GetFileById(batchRequest.InputFileId, userId)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, fmt.Errorf("no such file: %s", batchRequest.InputFileId))
+		return
+	}
+	if file.Purpose != dbmodel.FilePurposeBatch {
+		abortWithOpenAIError(c, http.StatusBadRequest, errors.New("the input file must be uploaded with purpose batch"))
+		return
+	}
+	now := helper.GetTimestamp()
+	batch := &dbmodel.Batch{
+		Id:               "batch_" + random.GetUUID(),
+		UserId:           userId,
+		TokenId:          c.GetInt(ctxkey.TokenId),
+		Endpoint:         batchRequest.Endpoint,
+		InputFileId:      file.Id,
+		CompletionWindow: batchRequest.CompletionWindow,
+		Status:           dbmodel.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(batchRequest.Metadata) > 0 {
+		metadata, _ := json.Marshal(batchRequest.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	err = batch.Insert()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	notifyBatchWorker()
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+func GetBatch(c *gin.Context) {
+	id := c.Param("id")
+	batch, err := dbmodel.GetUserBatchById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such batch: %s", id))
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// fetch one more to know whether there are more batches
+	batches, err := dbmodel.GetUserBatches(c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]openai.Batch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batchObject(batch))
+	}
+	response := openai.ListResponse{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	}
+	if len(batches) > 0 {
+		response.FirstId = batches[0].Id
+		response.LastId = batches[len(batches)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func CancelBatch(c *gin.Context) {
+	id := c.Param("id")
+	userId := c.GetInt(ctxkey.Id)
+	batch, err := dbmodel.GetUserBatchById(id, userId)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such batch: %s", id))
+		return
+	}
+	ok, err := dbmodel.CancelBatch(id, userId)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		abortWithOpenAIError(c, http.StatusConflict, fmt.Errorf("cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	notifyBatchWorker()
+	batch, err = dbmodel.GetUserBatchById(id, userId)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
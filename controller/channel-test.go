@@ -97,9 +97,7 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 			modelName = modelNames[0]
 		}
 	}
-	if modelMap != nil && modelMap[modelName] != "" {
-		modelName = modelMap[modelName]
-	}
+	modelName, _ = model.MapModelName(modelName, modelMap)
 	meta.OriginModelName, meta.ActualModelName = request.Model, modelName
 	request.Model = modelName
 	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
@@ -240,19 +238,22 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 			isChannelEnabled := channel.Status == model.ChannelStatusEnabled
 			tik := time.Now()
 			testRequest := buildTestRequest("")
-			_, err, openaiErr := testChannel(ctx, channel, testRequest)
+			// a channel with several keys is tested with one of them, which is disabled alone if it is bad
+			testedChannel := *channel
+			testedChannel.Key = model.PickChannelKey(channel, "")
+			_, err, openaiErr := testChannel(ctx, &testedChannel, testRequest)
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 			if isChannelEnabled && milliseconds > disableThreshold {
 				err = fmt.Errorf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
 				if config.AutomaticDisableChannelEnabled {
-					monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+					monitor.DisableChannel(channel.Id, channel.Name, "", err.Error())
 				} else {
 					_ = message.Notify(message.ByAll, fmt.Sprintf("渠道 %s （%d）测试超时", channel.Name, channel.Id), "", err.Error())
 				}
 			}
 			if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
-				monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+				monitor.DisableChannel(channel.Id, channel.Name, testedChannel.Key, err.Error())
 			}
 			if !isChannelEnabled && monitor.ShouldEnableChannel(err, openaiErr) {
 				monitor.EnableChannel(channel.Id, channel.Name)
@@ -66,6 +66,14 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	channel.Keys, err = model.GetChannelKeys(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -86,6 +94,10 @@ func AddChannel(c *gin.Context) {
 	}
 	channel.CreatedTime = helper.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if channel.KeyPolicy != nil && *channel.KeyPolicy != "" {
+		// a single channel using all the keys
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
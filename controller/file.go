@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+func fileObject(file *dbmodel.File) openai.File {
+	return openai.File{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func UploadFile(c *gin.Context) {
+	maxSize := int64(config.MaxFileSize) << 20
+	// leave some room for the other fields of the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	err := c.Request.ParseMultipartForm(32 << 20)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			abortWithOpenAIError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("the file must not be larger than %d MB", config.MaxFileSize))
+			return
+		}
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		abortWithOpenAIError(c, http.StatusBadRequest, errors.New("purpose is required"))
+		return
+	}
+	if !dbmodel.IsUploadPurpose(purpose) {
+		abortWithOpenAIError(c, http.StatusBadRequest, fmt.Errorf("unsupported purpose: %s", purpose))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	if fileHeader.Size > maxSize {
+		abortWithOpenAIError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("the file must not be larger than %d MB", config.MaxFileSize))
+		return
+	}
+	err = os.MkdirAll(config.FileStorageDir, 0755)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	file := &dbmodel.File{
+		Id:        "file-" + random.GetUUID(),
+		UserId:    c.GetInt(ctxkey.Id),
+		Bytes:     fileHeader.Size,
+		Filename:  fileHeader.Filename,
+		Purpose:   purpose,
+		CreatedAt: helper.GetTimestamp(),
+	}
+	err = c.SaveUploadedFile(fileHeader, file.Path())
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	err = file.Insert()
+	if err != nil {
+		_ = os.Remove(file.Path())
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+func ListFiles(c *gin.Context) {
+	files, err := dbmodel.GetUserFiles(c.GetInt(ctxkey.Id), c.Query("purpose"))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, err)
+		return
+	}
+	data := make([]openai.File, 0, len(files))
+	for _, file := range files {
+		data = append(data, fileObject(file))
+	}
+	c.JSON(http.StatusOK, openai.ListResponse{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func GetFile(c *gin.Context) {
+	id := c.Param("id")
+	file, err := dbmodel.GetFileById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such file: %s", id))
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+func GetFileContent(c *gin.Context) {
+	id := c.Param("id")
+	file, err := dbmodel.GetFileById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such file: %s", id))
+		return
+	}
+	c.FileAttachment(file.Path(), file.Filename)
+}
+
+func DeleteFile(c *gin.Context) {
+	id := c.Param("id")
+	err := dbmodel.DeleteFileById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such file: %s", id))
+		return
+	}
+	c.JSON(http.StatusOK, openai.FileDeleted{
+		Id:      id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
@@ -129,16 +129,19 @@ func ListAllModels(c *gin.Context) {
 	})
 }
 
-func ListModels(c *gin.Context) {
-	ctx := c.Request.Context()
-	var availableModels []string
+// getTokenAvailableModels returns the models of the token, or of the group of its user if the token is not limited.
+func getTokenAvailableModels(c *gin.Context) []string {
 	if c.GetString(ctxkey.AvailableModels) != "" {
-		availableModels = strings.Split(c.GetString(ctxkey.AvailableModels), ",")
-	} else {
-		userId := c.GetInt(ctxkey.Id)
-		userGroup, _ := model.CacheGetUserGroup(userId)
-		availableModels, _ = model.CacheGetGroupModels(ctx, userGroup)
+		return strings.Split(c.GetString(ctxkey.AvailableModels), ",")
 	}
+	userId := c.GetInt(ctxkey.Id)
+	userGroup, _ := model.CacheGetUserGroup(userId)
+	availableModels, _ := model.CacheGetGroupModels(c.Request.Context(), userGroup)
+	return availableModels
+}
+
+func ListModels(c *gin.Context) {
+	availableModels := getTokenAvailableModels(c)
 	modelSet := make(map[string]bool)
 	for _, availableModel := range availableModels {
 		modelSet[availableModel] = true
@@ -162,16 +165,42 @@ func ListModels(c *gin.Context) {
 			})
 		}
 	}
+	// aliases are listed along with the models they stand for
+	aliases, modelNames := model.GetModelAliases()
+	for i, alias := range aliases {
+		_, available := modelSet[modelNames[i]]
+		_, listed := modelSet[alias]
+		if available && !listed {
+			availableOpenAIModels = append(availableOpenAIModels, aliasModel(alias, modelNames[i]))
+		}
+	}
 	c.JSON(200, gin.H{
 		"object": "list",
 		"data":   availableOpenAIModels,
 	})
 }
 
+// aliasModel describes an alias as the model it stands for.
+func aliasModel(alias string, modelName string) OpenAIModels {
+	aliased, ok := modelsMap[modelName]
+	if !ok {
+		aliased = OpenAIModels{
+			Object:  "model",
+			Created: 1626777600,
+			OwnedBy: "custom",
+		}
+	}
+	aliased.Id = alias
+	aliased.Root = modelName
+	return aliased
+}
+
 func RetrieveModel(c *gin.Context) {
 	modelId := c.Param("model")
-	if model, ok := modelsMap[modelId]; ok {
-		c.JSON(200, model)
+	if openAIModel, ok := modelsMap[modelId]; ok {
+		c.JSON(200, openAIModel)
+	} else if modelName, ok := model.GetModelAlias(modelId); ok {
+		c.JSON(200, aliasModel(modelId, modelName))
 	} else {
 		Error := relaymodel.Error{
 			Message: fmt.Sprintf("The model '%s' does not exist", modelId),
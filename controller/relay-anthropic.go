@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// https://docs.anthropic.com/en/api/messages
+
+func getAnthropicRequest(c *gin.Context) (*anthropic.InboundRequest, bool) {
+	claudeRequest := &anthropic.InboundRequest{}
+	err := common.UnmarshalBodyReusable(c, claudeRequest)
+	if err == nil && claudeRequest.Model == "" {
+		err = errors.New("model is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, anthropic.ErrorResponse{
+			Type: "error",
+			Error: anthropic.Error{
+				Type:    "invalid_request_error",
+				Message: err.Error(),
+			},
+		})
+		return nil, false
+	}
+	return claudeRequest, true
+}
+
+func countAnthropicTokens(claudeRequest *anthropic.InboundRequest) int {
+	textRequest := anthropic.ConvertInboundRequest(claudeRequest)
+	tokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	if len(claudeRequest.Tools) > 0 {
+		toolsJson, _ := json.Marshal(claudeRequest.Tools)
+		tokens += openai.CountTokenText(string(toolsJson), textRequest.Model)
+	}
+	return tokens
+}
+
+// RelayAnthropicMessages serves Claude-native clients on top of the chat completions pipeline,
+// so the request can be answered by a channel of any type.
+func RelayAnthropicMessages(c *gin.Context) {
+	claudeRequest, ok := getAnthropicRequest(c)
+	if !ok {
+		return
+	}
+	textRequest := anthropic.ConvertInboundRequest(claudeRequest)
+	converter := anthropic.NewInboundConverter(claudeRequest.Model, countAnthropicTokens(claudeRequest))
+	relayAsChatCompletion(c, textRequest, converter)
+}
+
+func CountAnthropicTokens(c *gin.Context) {
+	claudeRequest, ok := getAnthropicRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, anthropic.CountTokensResponse{
+		InputTokens: countAnthropicTokens(claudeRequest),
+	})
+}
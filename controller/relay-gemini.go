@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/controller"
+)
+
+// https://ai.google.dev/api/generate-content
+
+func abortWithGeminiError(c *gin.Context, statusCode int, message string) {
+	c.Data(statusCode, "application/json", gemini.ErrorBody(statusCode, message))
+}
+
+// CountGeminiTokens answers /v1beta/models/{model}:countTokens locally and ends the chain there, the
+// generation methods go on to the distributor, which only they need.
+func CountGeminiTokens(c *gin.Context) {
+	modelName, method, _ := strings.Cut(c.Param("action"), ":")
+	if modelName == "" {
+		abortWithGeminiError(c, http.StatusBadRequest, "model is required")
+		c.Abort()
+		return
+	}
+	switch method {
+	case "generateContent", "streamGenerateContent":
+		return
+	case "countTokens":
+	default:
+		abortWithGeminiError(c, http.StatusNotFound, fmt.Sprintf("method %s is not supported", method))
+		c.Abort()
+		return
+	}
+	defer c.Abort()
+	countRequest := &gemini.CountTokensRequest{}
+	err := common.UnmarshalBodyReusable(c, countRequest)
+	if err != nil {
+		abortWithGeminiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	geminiRequest := countRequest.GenerateContentRequest
+	if geminiRequest == nil {
+		geminiRequest = &gemini.InboundRequest{Contents: countRequest.Contents}
+	}
+	textRequest := gemini.ConvertInboundRequest(modelName, geminiRequest, false)
+	c.JSON(http.StatusOK, gemini.CountTokensResponse{
+		TotalTokens: controller.CountChatPromptTokens(textRequest),
+	})
+}
+
+// RelayGeminiNative serves /v1beta/models/{model}:generateContent and :streamGenerateContent on top of
+// the chat completions pipeline, so that Gemini-native clients can be answered by a channel of any type.
+func RelayGeminiNative(c *gin.Context) {
+	modelName, method, _ := strings.Cut(c.Param("action"), ":")
+	geminiRequest := &gemini.InboundRequest{}
+	err := common.UnmarshalBodyReusable(c, geminiRequest)
+	if err != nil {
+		abortWithGeminiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	stream := method == "streamGenerateContent"
+	textRequest := gemini.ConvertInboundRequest(modelName, geminiRequest, stream)
+	converter := gemini.NewInboundConverter(modelName, controller.CountChatPromptTokens(textRequest), c.Query("alt") == "sse")
+	relayAsChatCompletion(c, textRequest, converter)
+}
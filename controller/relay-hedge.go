@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// A hedged request is sent once more to another channel when the channel it was sent to has not
+// answered within its usual latency, the HEDGE_PERCENTILE of its latest requests. The first of the
+// two to succeed is sent to the client and billed, the other one is cancelled.
+
+// hedgeWriter keeps the response of one of the requests of a hedge until it is known to be used.
+type hedgeWriter struct {
+	gin.ResponseWriter
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	written bool
+}
+
+func newHedgeWriter(w gin.ResponseWriter) *hedgeWriter {
+	return &hedgeWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) Status() int {
+	return w.status
+}
+
+func (w *hedgeWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.written
+}
+
+func (w *hedgeWriter) Flush() {}
+
+// flushTo sends the kept response to the client.
+func (w *hedgeWriter) flushTo(dst gin.ResponseWriter) {
+	for key, values := range w.header {
+		dst.Header()[key] = values
+	}
+	dst.WriteHeader(w.status)
+	_, _ = dst.Write(w.body.Bytes())
+}
+
+// hedgeRace decides which request of a hedge answers the client.
+type hedgeRace struct {
+	sync.Mutex
+	answered bool
+	hedged   bool
+}
+
+// claim is called by a request of the hedge once it has succeeded, only the first one gets the response.
+func (r *hedgeRace) claim(c *gin.Context) bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.answered {
+		return false
+	}
+	r.answered = true
+	c.Set(ctxkey.Hedged, r.hedged)
+	return true
+}
+
+// hedge tells whether the duplicate may still be sent.
+func (r *hedgeRace) hedge() bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.answered {
+		return false
+	}
+	r.hedged = true
+	return true
+}
+
+type hedgeAttempt struct {
+	c      *gin.Context
+	writer *hedgeWriter
+	cancel context.CancelFunc
+	bizErr *model.ErrorWithStatusCode
+	// lost is set when the other request of the hedge has answered first
+	lost      bool
+	cancelled bool
+}
+
+func newHedgeAttempt(c *gin.Context, race *hedgeRace, requestBody []byte) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attempt := &hedgeAttempt{c: c.Copy(), writer: newHedgeWriter(c.Writer), cancel: cancel}
+	attempt.c.Request = c.Request.Clone(ctx)
+	attempt.c.Set(ctxkey.UpstreamContext, ctx)
+	attempt.c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	attempt.c.Writer = attempt.writer
+	attempt.c.Set(ctxkey.HedgeClaim, func() bool {
+		attempt.lost = !race.claim(attempt.c)
+		return !attempt.lost
+	})
+	return attempt
+}
+
+func (a *hedgeAttempt) run(relayMode int, done chan<- *hedgeAttempt) {
+	// the request runs outside of the panic recovery of the router
+	defer func() {
+		if err := recover(); err != nil {
+			ctx := a.c.Request.Context()
+			logger.Errorf(ctx, fmt.Sprintf("panic detected: %v", err))
+			logger.Errorf(ctx, fmt.Sprintf("stacktrace from panic: %s", string(debug.Stack())))
+			a.bizErr = openai.ErrorWrapper(fmt.Errorf("panic detected: %v", err), "one_api_panic", http.StatusInternalServerError)
+		}
+		a.cancelled = a.c.Request.Context().Err() != nil
+		done <- a
+	}()
+	a.bizErr = relayHelperWithStats(a.c, relayMode)
+}
+
+// failed tells whether the request failed on its own rather than for losing the hedge.
+func (a *hedgeAttempt) failed() bool {
+	return a.bizErr != nil && !a.lost && !a.cancelled
+}
+
+// shouldHedge tells whether the request is hedged, which its group or token opt in to. Only the
+// non-streaming requests billed by the text relay are, a stream cannot be taken back once started.
+func shouldHedge(c *gin.Context, relayMode int) bool {
+	switch relayMode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Embeddings, relaymode.Moderations:
+	default:
+		return false
+	}
+	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
+		return false
+	}
+	if !c.GetBool(ctxkey.Hedge) && !slices.Contains(config.HedgeGroups, c.GetString(ctxkey.Group)) {
+		return false
+	}
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return false
+	}
+	return !request.Stream
+}
+
+// hedgeDelay is how long the channel is given before the request is sent to another one.
+func hedgeDelay(channelId int, modelName string) time.Duration {
+	if delay, ok := dbmodel.ChannelLatencyPercentile(channelId, modelName, config.HedgePercentile); ok {
+		return delay
+	}
+	return time.Duration(config.HedgeDefaultDelay) * time.Millisecond
+}
+
+// relayWithHedge is relayHelperWithStats hedging the request if it should be. The context ends up
+// as if the request had only been sent to the channel which answered, or to the first channel if
+// both failed.
+func relayWithHedge(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	if !shouldHedge(c, relayMode) {
+		return relayHelperWithStats(c, relayMode)
+	}
+	ctx := c.Request.Context()
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return relayHelperWithStats(c, relayMode)
+	}
+	group, modelName, channelId := c.GetString(ctxkey.Group), c.GetString(ctxkey.OriginalModel), c.GetInt(ctxkey.ChannelId)
+	race := &hedgeRace{}
+	done := make(chan *hedgeAttempt, 2)
+	primary := newHedgeAttempt(c, race, requestBody)
+	go primary.run(relayMode, done)
+	attempts := []*hedgeAttempt{primary}
+
+	var finished *hedgeAttempt
+	var hedgeChannel *dbmodel.Channel
+	timer := time.NewTimer(hedgeDelay(channelId, modelName))
+	select {
+	case finished = <-done:
+	case <-timer.C:
+		hedgeChannel, _ = dbmodel.CacheGetHedgeChannel(group, modelName, channelId, c.GetInt(ctxkey.PromptTokens))
+		if hedgeChannel != nil && !race.hedge() {
+			dbmodel.ReleaseChannelSlot(hedgeChannel)
+			dbmodel.ReleaseChannelBudget(hedgeChannel, modelName)
+			dbmodel.ReleaseCircuitProbe(hedgeChannel.Id, modelName)
+			hedgeChannel = nil
+		}
+		if hedgeChannel != nil {
+			logger.Infof(ctx, "channel #%d has not answered in time, hedging with channel #%d", channelId, hedgeChannel.Id)
+			hedge := newHedgeAttempt(c, race, requestBody)
+			hedge.c.Set(ctxkey.ChannelSlot, hedgeChannel)
+			middleware.SetupContextForSelectedChannel(hedge.c, hedgeChannel, modelName)
+			go hedge.run(relayMode, done)
+			attempts = append(attempts, hedge)
+		}
+	}
+	timer.Stop()
+
+	result := primary
+	for pending := len(attempts); pending > 0; pending-- {
+		if finished == nil {
+			finished = <-done
+		}
+		if finished.bizErr == nil {
+			result = finished
+			for _, attempt := range attempts {
+				attempt.cancel()
+			}
+		}
+		finished = nil
+	}
+	if hedgeChannel != nil {
+		dbmodel.ReleaseChannelSlot(hedgeChannel)
+	}
+	userId := c.GetInt(ctxkey.Id)
+	for _, attempt := range attempts {
+		attempt.cancel()
+		if attempt != result && attempt.failed() {
+			go processChannelRelayError(ctx, userId, attempt.c.GetInt(ctxkey.ChannelId), attempt.c.GetString(ctxkey.ChannelName),
+				attempt.c.GetString(ctxkey.ChannelKey), *attempt.bizErr)
+		}
+	}
+
+	for key, value := range result.c.Keys {
+		if key != ctxkey.ChannelSlot && key != ctxkey.HedgeClaim {
+			c.Set(key, value)
+		}
+	}
+	if result.bizErr != nil {
+		return result.bizErr
+	}
+	if len(attempts) > 1 {
+		logger.Infof(ctx, "hedged request answered by channel #%d", result.c.GetInt(ctxkey.ChannelId))
+	}
+	result.writer.flushTo(c.Writer)
+	return nil
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestRelayWithHedge(t *testing.T) {
+	Convey("relayWithHedge", t, func() {
+		gin.SetMode(gin.TestMode)
+		var err error
+		model.DB, err = gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		So(err, ShouldBeNil)
+		model.LOG_DB = model.DB
+		So(model.DB.AutoMigrate(&model.User{}, &model.Token{}, &model.Channel{}, &model.Ability{}, &model.ChannelKey{}, &model.Log{}), ShouldBeNil)
+		common.UsingSQLite = true
+		common.RedisEnabled = false
+		config.MemoryCacheEnabled = false
+		config.BatchUpdateEnabled = false
+		client.Init()
+		hedgeGroups, hedgeDefaultDelay := config.HedgeGroups, config.HedgeDefaultDelay
+		config.HedgeGroups = []string{"default"}
+		defer func() {
+			config.HedgeGroups, config.HedgeDefaultDelay = hedgeGroups, hedgeDefaultDelay
+		}()
+		So(model.DB.Create(&model.User{Id: 1, Username: "test", Password: "12345678", Group: "default", Quota: 100000000}).Error, ShouldBeNil)
+		So(model.DB.Create(&model.Token{Id: 1, UserId: 1, Key: "testtoken", Name: "test", Status: model.TokenStatusEnabled,
+			ExpiredTime: -1, UnlimitedQuota: true}).Error, ShouldBeNil)
+
+		// the slow upstream answers after a second unless the request is cancelled before
+		slowCancelled := make(chan bool, 1)
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the server only notices the client going away once the body is read
+			_, _ = io.Copy(io.Discard, r.Body)
+			select {
+			case <-r.Context().Done():
+				slowCancelled <- true
+			case <-time.After(time.Second):
+				slowCancelled <- false
+				writeEmbedding(w, "slow")
+			}
+		}))
+		defer slow.Close()
+		fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeEmbedding(w, "fast")
+		}))
+		defer fast.Close()
+		channels := make(map[string]*model.Channel)
+		for id, upstream := range map[int]*httptest.Server{1: slow, 2: fast} {
+			baseURL := upstream.URL
+			channel := &model.Channel{Id: id, Type: channeltype.OpenAI, Name: fmt.Sprintf("channel-%d", id), Status: model.ChannelStatusEnabled,
+				Key: "sk-test", Models: "text-embedding-3-small", Group: "default", BaseURL: &baseURL}
+			So(model.DB.Create(channel).Error, ShouldBeNil)
+			So(channel.AddAbilities(), ShouldBeNil)
+			channels[upstream.URL] = channel
+		}
+		serve := func(primary *model.Channel) *httptest.ResponseRecorder {
+			engine := gin.New()
+			engine.POST("/v1/embeddings", func(c *gin.Context) {
+				c.Set(ctxkey.Id, 1)
+				c.Set(ctxkey.TokenId, 1)
+				c.Set(ctxkey.TokenName, "test")
+				c.Set(ctxkey.Group, "default")
+				c.Set(ctxkey.RequestModel, "text-embedding-3-small")
+				middleware.SetupContextForSelectedChannel(c, primary, "text-embedding-3-small")
+			}, Relay)
+			w := httptest.NewRecorder()
+			// embeddings are billed as chats are without the tokenizer to count their prompt
+			request := httptest.NewRequest(http.MethodPost, "/v1/embeddings",
+				strings.NewReader(`{"model":"text-embedding-3-small","input":"hi"}`))
+			request.Header.Set("Content-Type", "application/json")
+			engine.ServeHTTP(w, request)
+			return w
+		}
+		// consumeLogs waits for the logs billed in the background
+		consumeLogs := func() []model.Log {
+			var logs []model.Log
+			for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+				So(model.LOG_DB.Where("type = ?", model.LogTypeConsume).Find(&logs).Error, ShouldBeNil)
+				if len(logs) > 0 {
+					break
+				}
+			}
+			// gives the losing request the time to bill if it wrongly did
+			time.Sleep(200 * time.Millisecond)
+			So(model.LOG_DB.Where("type = ?", model.LogTypeConsume).Find(&logs).Error, ShouldBeNil)
+			return logs
+		}
+
+		Convey("answers with the hedge when the channel is too slow and bills it once", func() {
+			config.HedgeDefaultDelay = 50
+			w := serve(channels[slow.URL])
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var response struct {
+				Id string `json:"id"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Id, ShouldEqual, "fast")
+			So(<-slowCancelled, ShouldBeTrue)
+			logs := consumeLogs()
+			So(logs, ShouldHaveLength, 1)
+			So(logs[0].ChannelId, ShouldEqual, channels[fast.URL].Id)
+			So(logs[0].Hedged, ShouldBeTrue)
+			user, err := model.GetUserById(1, false)
+			So(err, ShouldBeNil)
+			So(user.RequestCount, ShouldEqual, 1)
+			So(user.UsedQuota, ShouldEqual, logs[0].Quota)
+		})
+
+		Convey("does not hedge a channel answering in time", func() {
+			config.HedgeDefaultDelay = 1000
+			w := serve(channels[fast.URL])
+			So(w.Code, ShouldEqual, http.StatusOK)
+			logs := consumeLogs()
+			So(logs, ShouldHaveLength, 1)
+			So(logs[0].Hedged, ShouldBeFalse)
+		})
+
+		Convey("turns a panic of a request into an error", func() {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+			attempt := newHedgeAttempt(c, &hedgeRace{}, []byte(`{"model":"text-embedding-3-small","input":"hi"}`))
+			attempt.c.Set(ctxkey.Config, "not a channel config")
+			done := make(chan *hedgeAttempt, 1)
+			go attempt.run(relaymode.Embeddings, done)
+			So(<-done, ShouldEqual, attempt)
+			So(attempt.bizErr, ShouldNotBeNil)
+			So(attempt.bizErr.StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(attempt.bizErr.Error.Code, ShouldEqual, "one_api_panic")
+			So(attempt.failed(), ShouldBeTrue)
+		})
+	})
+}
+
+func writeEmbedding(w http.ResponseWriter, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{"id":"`+id+`","object":"list","model":"text-embedding-3-small",`+
+		`"data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":10,"total_tokens":10}}`)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+
+func abortWithOllamaError(c *gin.Context, statusCode int, message string) {
+	c.Data(statusCode, "application/json; charset=utf-8", ollama.ErrorBody(message))
+}
+
+func RelayOllamaChat(c *gin.Context) {
+	chatRequest := &ollama.InboundChatRequest{}
+	err := common.UnmarshalBodyReusable(c, chatRequest)
+	if err != nil {
+		abortWithOllamaError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	textRequest := ollama.ConvertInboundChatRequest(chatRequest)
+	promptTokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	relayAsChatCompletion(c, textRequest, ollama.NewInboundConverter(chatRequest.Model, promptTokens, false))
+}
+
+func RelayOllamaGenerate(c *gin.Context) {
+	generateRequest := &ollama.GenerateRequest{}
+	err := common.UnmarshalBodyReusable(c, generateRequest)
+	if err != nil {
+		abortWithOllamaError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	textRequest := ollama.ConvertInboundGenerateRequest(generateRequest)
+	promptTokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	relayAsChatCompletion(c, textRequest, ollama.NewInboundConverter(generateRequest.Model, promptTokens, true))
+}
+
+func RelayOllamaEmbed(c *gin.Context) {
+	embeddingRequest := &ollama.InboundEmbeddingRequest{}
+	err := common.UnmarshalBodyReusable(c, embeddingRequest)
+	if err != nil {
+		abortWithOllamaError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	textRequest := ollama.ConvertInboundEmbeddingRequest(embeddingRequest)
+	relayAsOpenAI(c, "/v1/embeddings", textRequest, ollama.NewEmbeddingConverter(embeddingRequest.Model))
+}
+
+// ListOllamaTags lists the models of the token as if they were pulled into a local Ollama.
+func ListOllamaTags(c *gin.Context) {
+	modifiedAt := time.Unix(1626777600, 0).UTC().Format(time.RFC3339)
+	tags := ollama.TagsResponse{
+		Models: make([]ollama.ModelInfo, 0),
+	}
+	for _, modelName := range getTokenAvailableModels(c) {
+		tags.Models = append(tags.Models, ollama.ModelInfo{
+			Name:       modelName,
+			Model:      modelName,
+			ModifiedAt: modifiedAt,
+			Details: ollama.ModelDetails{
+				Families: []string{},
+			},
+		})
+	}
+	c.JSON(http.StatusOK, tags)
+}
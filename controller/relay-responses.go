@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+
+// RelayResponses serves the Responses API on top of the chat completions pipeline,
+// the conversation state is kept in the database so that previous_response_id works with any channel.
+func RelayResponses(c *gin.Context) {
+	ctx := c.Request.Context()
+	responsesRequest := &openai.ResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err == nil && responsesRequest.Model == "" {
+		err = errors.New("model is required")
+	}
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	var history []model.Message
+	if responsesRequest.PreviousResponseId != "" {
+		previous, err := dbmodel.GetResponseById(responsesRequest.PreviousResponseId, userId)
+		if err != nil {
+			abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("previous response with id '%s' not found", responsesRequest.PreviousResponseId))
+			return
+		}
+		if err = json.Unmarshal([]byte(previous.Messages), &history); err != nil {
+			abortWithOpenAIError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	input := openai.ConvertResponsesInput(responsesRequest.Input)
+	textRequest := openai.ConvertResponsesRequest(responsesRequest, history, input)
+	promptTokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	converter := openai.NewResponsesConverter(responsesRequest, promptTokens)
+	relayAsChatCompletion(c, textRequest, converter)
+
+	result := converter.Result()
+	if result == nil || !responsesRequest.ShouldStore() {
+		return
+	}
+	messages := append(history, input...)
+	messages = append(messages, converter.OutputMessage())
+	messagesJson, err := json.Marshal(messages)
+	if err != nil {
+		logger.Errorf(ctx, "failed to marshal response messages: %s", err.Error())
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf(ctx, "failed to marshal response: %s", err.Error())
+		return
+	}
+	response := &dbmodel.Response{
+		Id:                 result.Id,
+		UserId:             userId,
+		TokenId:            c.GetInt(ctxkey.TokenId),
+		Model:              responsesRequest.Model,
+		PreviousResponseId: responsesRequest.PreviousResponseId,
+		Messages:           string(messagesJson),
+		Body:               string(body),
+		CreatedAt:          helper.GetTimestamp(),
+	}
+	if err = response.Insert(); err != nil {
+		logger.Errorf(ctx, "failed to store response %s: %s", result.Id, err.Error())
+	}
+}
+
+func GetResponse(c *gin.Context) {
+	id := c.Param("id")
+	response, err := dbmodel.GetResponseById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("response with id '%s' not found", id))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(response.Body))
+}
+
+func DeleteResponse(c *gin.Context) {
+	id := c.Param("id")
+	err := dbmodel.DeleteResponseById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("response with id '%s' not found", id))
+		return
+	}
+	c.JSON(http.StatusOK, openai.ResponsesDeleted{
+		Id:      id,
+		Object:  "response",
+		Deleted: true,
+	})
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// statsWriter notes when the first bytes of the response are written.
+type statsWriter struct {
+	gin.ResponseWriter
+	firstWriteAt time.Time
+}
+
+func (w *statsWriter) Write(data []byte) (int, error) {
+	if w.firstWriteAt.IsZero() {
+		w.firstWriteAt = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statsWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func isStreamContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/event-stream") || strings.HasPrefix(contentType, "application/x-ndjson")
+}
+
+// isChannelError tells whether an error is caused by the channel rather than by the request. The
+// errors raised before the request reached the upstream, e.g. for the quota of the user, are not.
+func isChannelError(c *gin.Context, bizErr *model.ErrorWithStatusCode) bool {
+	if !c.GetBool(ctxkey.UpstreamError) {
+		return false
+	}
+	switch bizErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return bizErr.StatusCode/100 == 5
+}
+
+// relayHelperWithStats is relayHelper feeding the channel statistics of adaptive balancing, the
+// circuit breakers, the rate limits and the key usage of the channel.
+func relayHelperWithStats(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	if relayMode == relaymode.Realtime {
+		// a session lasts as long as the client wants
+		return relayHelper(c, relayMode)
+	}
+	writer := &statsWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Set(ctxkey.UpstreamHeader, nil)
+	c.Set(ctxkey.UpstreamError, false)
+	startTime := time.Now()
+	bizErr := relayHelper(c, relayMode)
+	c.Writer = writer.ResponseWriter
+	channelId, originalModel := c.GetInt(ctxkey.ChannelId), c.GetString(ctxkey.OriginalModel)
+	if header, ok := c.Get(ctxkey.UpstreamHeader); ok && header != nil {
+		dbmodel.LearnChannelRateLimit(channelId, originalModel, header.(http.Header))
+	}
+	var tokens int
+	if usage, ok := c.Get(ctxkey.Usage); ok && usage != nil && bizErr == nil {
+		tokens = usage.(*model.Usage).TotalTokens
+	}
+	if channel, ok := c.Get(ctxkey.ChannelSlot); ok && channel != nil {
+		dbmodel.RecordChannelTokens(channel.(*dbmodel.Channel), originalModel, tokens)
+	}
+	// a request cancelled by the client or by a hedged duplicate says nothing about the channel
+	blameChannel := bizErr != nil && isChannelError(c, bizErr) && c.Request.Context().Err() == nil
+	dbmodel.RecordChannelKeyUsage(channelId, c.GetString(ctxkey.ChannelKey), !blameChannel, tokens)
+	if bizErr != nil && !blameChannel {
+		return bizErr
+	}
+	var firstToken time.Duration
+	if bizErr == nil && !writer.firstWriteAt.IsZero() && isStreamContentType(writer.Header().Get("Content-Type")) {
+		firstToken = writer.firstWriteAt.Sub(startTime)
+	}
+	dbmodel.RecordChannelRequest(channelId, originalModel, bizErr == nil, time.Since(startTime), firstToken)
+	dbmodel.RecordCircuitResult(channelId, originalModel, bizErr == nil)
+	return bizErr
+}
+
+func GetChannelStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    dbmodel.GetAllChannelStats(),
+	})
+}
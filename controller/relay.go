@@ -3,6 +3,7 @@ package controller
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,7 +27,9 @@ import (
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err = controller.RelayImageHelper(c, relayMode)
 	case relaymode.AudioSpeech:
 		fallthrough
@@ -36,6 +39,12 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case relaymode.Proxy:
 		err = controller.RelayProxyHelper(c, relayMode)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c, relayMode)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c, relayMode)
+	case relaymode.Videos:
+		err = controller.RelayVideoHelper(c, relayMode)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -49,9 +58,24 @@ func Relay(c *gin.Context) {
 		requestBody, _ := common.GetRequestBody(c)
 		logger.Debugf(ctx, "request body: %s", string(requestBody))
 	}
-	channelId := c.GetInt(ctxkey.ChannelId)
+	servedModel := c.GetString(ctxkey.RequestModel)
+	// the client asked for an alias of the model
+	rewriteModel := c.GetString(ctxkey.ModelAlias) != ""
+	if fallbackModel := c.GetString(ctxkey.FallbackModel); fallbackModel != "" {
+		// the distributor found no channel for the requested model
+		servedModel, rewriteModel = fallbackModel, true
+	}
+	if rewriteModel {
+		if err := middleware.SetRequestModel(c, servedModel); err != nil {
+			abortWithOpenAIError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	c.Header(helper.ModelKey, servedModel)
 	userId := c.GetInt(ctxkey.Id)
-	bizErr := relayHelper(c, relayMode)
+	bizErr := relayWithHedge(c, relayMode)
+	// a hedged request may have been answered by another channel
+	channelId := c.GetInt(ctxkey.ChannelId)
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
 		return
@@ -60,46 +84,99 @@ func Relay(c *gin.Context) {
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+	go processChannelRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.ChannelKey), *bizErr)
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
 	if !shouldRetry(c, bizErr.StatusCode) {
 		logger.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
 		retryTimes = 0
 	}
+	bizErr = retryRelay(c, relayMode, group, originalModel, retryTimes, lastFailedChannelId, bizErr)
+	if bizErr != nil && shouldRetry(c, bizErr.StatusCode) {
+		bizErr = relayFallbacks(c, relayMode, group, originalModel, bizErr)
+	}
+	if bizErr != nil {
+		if bizErr.StatusCode == http.StatusTooManyRequests {
+			bizErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
+		}
+
+		// BUG: bizErr is in race condition
+		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": bizErr.Error,
+		})
+	}
+}
+
+// retryRelay sends the request to other channels of the model until it succeeds or the retries run out.
+func retryRelay(c *gin.Context, relayMode int, group string, modelName string, retryTimes int, lastFailedChannelId int, bizErr *model.ErrorWithStatusCode) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	userId := c.GetInt(ctxkey.Id)
 	for i := retryTimes; i > 0; i-- {
-		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes)
+		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, modelName, i != retryTimes, c.GetInt(ctxkey.PromptTokens))
 		if err != nil {
 			logger.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %+v", err)
 			break
 		}
 		logger.Infof(ctx, "using channel #%d to retry (remain times %d)", channel.Id, i)
 		if channel.Id == lastFailedChannelId {
+			dbmodel.ReleaseChannelSlot(channel)
+			dbmodel.ReleaseChannelBudget(channel, modelName)
+			dbmodel.ReleaseCircuitProbe(channel.Id, modelName)
 			continue
 		}
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		middleware.HoldChannelSlot(c, channel)
+		middleware.SetupContextForSelectedChannel(c, channel, modelName)
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		bizErr = relayHelper(c, relayMode)
+		bizErr = relayWithHedge(c, relayMode)
 		if bizErr == nil {
-			return
+			return nil
 		}
 		channelId := c.GetInt(ctxkey.ChannelId)
 		lastFailedChannelId = channelId
 		channelName := c.GetString(ctxkey.ChannelName)
-		go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+		go processChannelRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.ChannelKey), *bizErr)
 	}
-	if bizErr != nil {
-		if bizErr.StatusCode == http.StatusTooManyRequests {
-			bizErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
-		}
+	return bizErr
+}
 
-		// BUG: bizErr is in race condition
-		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
-		c.JSON(bizErr.StatusCode, gin.H{
-			"error": bizErr.Error,
-		})
+// relayFallbacks walks the fallback chain of the requested model once the channels of the model
+// have failed, every fallback model gets the same retries as the requested one.
+func relayFallbacks(c *gin.Context, relayMode int, group string, failedModel string, bizErr *model.ErrorWithStatusCode) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	userId := c.GetInt(ctxkey.Id)
+	for _, fallbackModel := range middleware.GetFallbackModels(c, c.GetString(ctxkey.RequestModel)) {
+		if fallbackModel == failedModel {
+			continue
+		}
+		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, fallbackModel, false, c.GetInt(ctxkey.PromptTokens))
+		if err != nil {
+			continue
+		}
+		logger.Infof(ctx, "falling back to model %s on channel #%d", fallbackModel, channel.Id)
+		middleware.HoldChannelSlot(c, channel)
+		middleware.SetupContextForSelectedChannel(c, channel, fallbackModel)
+		if err := middleware.SetRequestModel(c, fallbackModel); err != nil {
+			logger.Errorf(ctx, "failed to fall back to model %s: %s", fallbackModel, err.Error())
+			return bizErr
+		}
+		c.Header(helper.ModelKey, fallbackModel)
+		bizErr = relayWithHedge(c, relayMode)
+		if bizErr == nil {
+			return nil
+		}
+		channelId := c.GetInt(ctxkey.ChannelId)
+		go processChannelRelayError(ctx, userId, channelId, c.GetString(ctxkey.ChannelName), c.GetString(ctxkey.ChannelKey), *bizErr)
+		if !shouldRetry(c, bizErr.StatusCode) {
+			return bizErr
+		}
+		bizErr = retryRelay(c, relayMode, group, fallbackModel, config.RetryTimes, channelId, bizErr)
+		if bizErr == nil || !shouldRetry(c, bizErr.StatusCode) {
+			return bizErr
+		}
 	}
+	return bizErr
 }
 
 func shouldRetry(c *gin.Context, statusCode int) bool {
@@ -121,16 +198,57 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	return true
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err model.ErrorWithStatusCode) {
+func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, key string, err model.ErrorWithStatusCode) {
 	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
+	if err.Code == "context_length_exceeded" {
+		// the prompt is too long for the channel, which is not at fault
+		return
+	}
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
 	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
-		monitor.DisableChannel(channelId, channelName, err.Message)
+		monitor.DisableChannel(channelId, channelName, key, err.Message)
 	} else {
 		monitor.Emit(channelId, false)
 	}
 }
 
+// relayAsChatCompletion feeds a request that has been converted to the chat completions format
+// through Relay, the converter turns the output back into the format the client expects.
+func relayAsChatCompletion(c *gin.Context, textRequest *model.GeneralOpenAIRequest, converter controller.InboundConverter) {
+	relayAsOpenAI(c, "/v1/chat/completions", textRequest, converter)
+}
+
+// relayAsOpenAI is relayAsChatCompletion for the other OpenAI endpoints.
+func relayAsOpenAI(c *gin.Context, path string, request any, converter controller.InboundConverter) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		c.Data(http.StatusInternalServerError, converter.ContentType(false), converter.ConvertError(http.StatusInternalServerError, []byte(err.Error())))
+		return
+	}
+	c.Set(ctxkey.KeyRequestBody, jsonData)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.URL.Path = path
+	c.Request.URL.RawQuery = ""
+	writer := controller.NewInboundWriter(c.Writer, converter)
+	c.Writer = writer
+	Relay(c)
+	var usage *model.Usage
+	if v, ok := c.Get(ctxkey.Usage); ok {
+		usage, _ = v.(*model.Usage)
+	}
+	writer.Finish(usage)
+}
+
+func abortWithOpenAIError(c *gin.Context, statusCode int, err error) {
+	c.JSON(statusCode, gin.H{
+		"error": model.Error{
+			Message: err.Error(),
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := model.Error{
 		Message: "API not implemented",
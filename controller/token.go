@@ -150,6 +150,7 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		Hedge:          token.Hedge,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +240,7 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.Hedge = token.Hedge
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// The video task worker runs on the master node. It polls the upstream of every unfinished task
+// through the adaptor of its channel, then charges the pre-consumed quota of the tasks that
+// succeeded and returns the one of the tasks that failed or timed out.
+
+func AutomaticallyUpdateVideoTasks(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		tasks, err := dbmodel.GetUnfinishedVideoTasks()
+		if err != nil {
+			logger.SysError("failed to get unfinished video tasks: " + err.Error())
+			continue
+		}
+		for _, task := range tasks {
+			updateVideoTask(task)
+		}
+	}
+}
+
+func updateVideoTask(task *dbmodel.VideoTask) {
+	if helper.GetTimestamp()-task.CreatedAt > int64(config.VideoTaskTimeout) {
+		finishVideoTask(task, &relaymodel.VideoTask{
+			Status: relaymodel.VideoStatusFailed,
+			Error:  "video generation timed out",
+		})
+		return
+	}
+	upstreamTask, err := fetchVideoTask(task)
+	if err != nil {
+		// left for the next round of the worker
+		logger.SysError(fmt.Sprintf("failed to update video task %s: %s", task.Id, err.Error()))
+		return
+	}
+	switch upstreamTask.Status {
+	case relaymodel.VideoStatusCompleted, relaymodel.VideoStatusFailed:
+		finishVideoTask(task, upstreamTask)
+		return
+	}
+	if upstreamTask.Status == task.Status && upstreamTask.Progress == task.Progress {
+		return
+	}
+	_, err = dbmodel.UpdateVideoTaskStatus(task.Id, upstreamTask.Status, map[string]any{
+		"progress":   upstreamTask.Progress,
+		"updated_at": helper.GetTimestamp(),
+	})
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to update video task %s: %s", task.Id, err.Error()))
+	}
+}
+
+func fetchVideoTask(task *dbmodel.VideoTask) (*relaymodel.VideoTask, error) {
+	channel, err := dbmodel.GetChannelById(task.ChannelId, true)
+	if err != nil {
+		return nil, err
+	}
+	// the task belongs to the account of the key it was created with
+	if key := channel.GetKeyByHash(task.KeyHash); key != "" {
+		channel.Key = key
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: "/v1/videos/" + task.Id},
+		Header: make(http.Header),
+	}
+	middleware.SetupContextForSelectedChannel(c, channel, task.Model)
+	meta := meta.GetByContext(c)
+	meta.OriginModelName, meta.ActualModelName = task.Model, task.ActualModel
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return nil, fmt.Errorf("invalid api type: %d", meta.APIType)
+	}
+	videoAdaptor, ok := a.(adaptor.VideoAdaptor)
+	if !ok {
+		return nil, fmt.Errorf("video generation is not supported by channel %s", a.GetChannelName())
+	}
+	a.Init(meta)
+	fullRequestURL, err := videoAdaptor.GetVideoTaskURL(meta, task.UpstreamTaskId)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	upstreamTask, err := videoAdaptor.ParseVideoTask(resp)
+	if err != nil {
+		return nil, err
+	}
+	if upstreamTask.Status == "" {
+		return nil, errors.New("upstream returned no task status")
+	}
+	return upstreamTask, nil
+}
+
+func finishVideoTask(task *dbmodel.VideoTask, upstreamTask *relaymodel.VideoTask) {
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	fields := map[string]any{
+		"updated_at":   now,
+		"completed_at": now,
+	}
+	if upstreamTask.Status == relaymodel.VideoStatusCompleted {
+		fields["progress"] = 100
+		fields["video_url"] = upstreamTask.VideoURL
+	} else {
+		fields["error"] = upstreamTask.Error
+	}
+	ok, err := dbmodel.UpdateVideoTaskStatus(task.Id, upstreamTask.Status, fields)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to finish video task %s: %s", task.Id, err.Error()))
+		return
+	}
+	if !ok {
+		return
+	}
+	if upstreamTask.Status != relaymodel.VideoStatusCompleted {
+		billing.ReturnPreConsumedQuota(ctx, task.Quota, task.TokenId)
+		return
+	}
+	if task.Quota == 0 {
+		return
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f，时长：%d 秒", task.ModelRatio, task.GroupRatio, task.Seconds)
+	if task.ModelPrice > 0 {
+		logContent = fmt.Sprintf("模型价格：$%.6f × %d 秒 × %.2f", task.ModelPrice, task.Seconds, task.GroupRatio)
+	}
+	dbmodel.RecordConsumeLog(ctx, &dbmodel.Log{
+		UserId:      task.UserId,
+		ChannelId:   task.ChannelId,
+		ModelName:   task.ActualModel,
+		TokenName:   task.TokenName,
+		Quota:       int(task.Quota),
+		Content:     logContent,
+		ElapsedTime: (now - task.CreatedAt) * 1000,
+	})
+	dbmodel.UpdateUserUsedQuotaAndRequestCount(task.UserId, task.Quota)
+	dbmodel.UpdateChannelUsedQuota(task.ChannelId, task.Quota)
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/controller"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/videos
+
+func GetVideo(c *gin.Context) {
+	id := c.Param("id")
+	task, err := dbmodel.GetUserVideoTaskById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusNotFound, fmt.Errorf("no such video: %s", id))
+		return
+	}
+	c.JSON(http.StatusOK, controller.VideoObject(task))
+}
+
+func ListVideos(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// fetch one more to know whether there are more videos
+	tasks, err := dbmodel.GetUserVideoTasks(c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, err)
+		return
+	}
+	hasMore := len(tasks) > limit
+	if hasMore {
+		tasks = tasks[:limit]
+	}
+	data := make([]relaymodel.Video, 0, len(tasks))
+	for _, task := range tasks {
+		data = append(data, controller.VideoObject(task))
+	}
+	response := openai.ListResponse{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	}
+	if len(tasks) > 0 {
+		response.FirstId = tasks[0].Id
+		response.LastId = tasks[len(tasks)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
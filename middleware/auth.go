@@ -92,6 +92,25 @@ func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			// Claude-native clients send the key in x-api-key
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" {
+			// Gemini-native clients send the key in x-goog-api-key or in the key query parameter
+			key = c.Request.Header.Get("x-goog-api-key")
+			if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+				key = c.Query("key")
+			}
+		}
+		if key == "" {
+			// browsers cannot set headers on a WebSocket, realtime clients pass the key as a subprotocol
+			for _, protocol := range strings.Split(c.Request.Header.Get("Sec-WebSocket-Protocol"), ",") {
+				if strings.HasPrefix(strings.TrimSpace(protocol), "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(strings.TrimSpace(protocol), "openai-insecure-api-key.")
+				}
+			}
+		}
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
 		parts := strings.Split(key, "-")
@@ -121,10 +140,16 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
+		// an alias is resolved before picking a channel, the relay puts the model into the request body
+		if modelName, ok := model.GetModelAlias(requestModel); ok && c.ContentType() == "application/json" {
+			c.Set(ctxkey.ModelAlias, requestModel)
+			requestModel = modelName
+		}
 		c.Set(ctxkey.RequestModel, requestModel)
 		if token.Models != nil && *token.Models != "" {
 			c.Set(ctxkey.AvailableModels, *token.Models)
-			if requestModel != "" && !isModelInList(requestModel, *token.Models) {
+			alias := c.GetString(ctxkey.ModelAlias)
+			if requestModel != "" && !isModelInList(requestModel, *token.Models) && (alias == "" || !isModelInList(alias, *token.Models)) {
 				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权使用模型：%s", requestModel))
 				return
 			}
@@ -132,6 +157,7 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.Hedge, token.Hedge)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -157,11 +183,36 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/chat/completions") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/fim/completions") {
+		return true
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images") {
 		return true
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/rerank") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		return true
+	}
+	switch c.Request.URL.Path {
+	case "/api/chat", "/api/generate", "/api/embed":
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/responses") && c.Request.Method == http.MethodPost {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/videos") && c.Request.Method == http.MethodPost {
+		return true
+	}
 	return false
 }
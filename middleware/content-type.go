@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSONContentType treats every request body as JSON, for the clients that send it without a Content-Type.
+func JSONContentType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+		c.Next()
+	}
+}
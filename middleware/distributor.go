@@ -1,16 +1,25 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
 )
 
 type ModelRequest struct {
@@ -43,8 +52,62 @@ func Distribute() func(c *gin.Context) {
 			}
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
+			promptTokens, counted := 0, false
+			// fitsContext tells whether some channel of the model takes a prompt this long
+			fitsContext := func(modelName string) bool {
+				maxContext, limited := model.CacheGetMaxContext(userGroup, modelName)
+				if !limited {
+					return true
+				}
+				if !counted {
+					promptTokens, counted = relaycontroller.CountPromptTokens(c), true
+					c.Set(ctxkey.PromptTokens, promptTokens)
+				}
+				return maxContext <= 0 || promptTokens <= maxContext
+			}
 			var err error
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			// a prompt too long for the model may still fit a fallback model
+			tooLong := !fitsContext(requestModel)
+			if !tooLong {
+				if affinity := getAffinityKey(c); affinity != "" {
+					c.Set(ctxkey.Affinity, affinity)
+					channel, err = model.CacheGetStickyChannel(userGroup, requestModel, affinity, promptTokens)
+				}
+				if channel == nil {
+					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false, promptTokens)
+				}
+			}
+			// a busy model is waited for, it is only switched to a fallback when it has no channel for the
+			// request or the wait timed out. The fallbacks of a failing one are walked by the retry loop.
+			waited := false
+			if busy, ok := err.(*model.ChannelBusyError); ok && busy.QueueTimeout > 0 {
+				logger.Infof(ctx, "channels of model %s are all busy, waiting up to %s", requestModel, busy.QueueTimeout)
+				channel, err = model.WaitForSatisfiedChannel(ctx, userGroup, requestModel, promptTokens, busy.QueueTimeout)
+				waited = true
+			}
+			if _, busy := err.(*model.ChannelBusyError); channel == nil && (!busy || waited) && ctx.Err() == nil {
+				for _, fallbackModel := range GetFallbackModels(c, requestModel) {
+					if !fitsContext(fallbackModel) {
+						continue
+					}
+					fallbackChannel, fallbackErr := model.CacheGetRandomSatisfiedChannel(userGroup, fallbackModel, false, promptTokens)
+					if fallbackErr == nil {
+						logger.Infof(ctx, "no channel available for model %s, falling back to %s", requestModel, fallbackModel)
+						channel, err, tooLong, requestModel = fallbackChannel, nil, false, fallbackModel
+						c.Set(ctxkey.FallbackModel, fallbackModel)
+						break
+					}
+				}
+			}
+			if tooLong {
+				maxContext, _ := model.CacheGetMaxContext(userGroup, requestModel)
+				abortWithMessage(c, http.StatusBadRequest, fmt.Sprintf("当前分组 %s 下对于模型 %s 的渠道最多支持 %d tokens 的上下文，请求的提示词有 %d tokens", userGroup, requestModel, maxContext, promptTokens))
+				return
+			}
+			if _, ok := err.(*model.ChannelBusyError); ok {
+				abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("当前分组 %s 下对于模型 %s 的渠道均已满载，请稍后再试", userGroup, requestModel))
+				return
+			}
 			if err != nil {
 				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, requestModel)
 				if channel != nil {
@@ -54,13 +117,30 @@ func Distribute() func(c *gin.Context) {
 				abortWithMessage(c, http.StatusServiceUnavailable, message)
 				return
 			}
+			HoldChannelSlot(c, channel)
 		}
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id)
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		// deferred so that the slot is given back even if the relay panics
+		defer releaseChannelSlot(c)
 		c.Next()
 	}
 }
 
+// HoldChannelSlot keeps the slot taken when the channel was picked until the request is done, and
+// gives back the one of the channel used before.
+func HoldChannelSlot(c *gin.Context, channel *model.Channel) {
+	releaseChannelSlot(c)
+	c.Set(ctxkey.ChannelSlot, channel)
+}
+
+func releaseChannelSlot(c *gin.Context) {
+	if channel, ok := c.Get(ctxkey.ChannelSlot); ok && channel != nil {
+		model.ReleaseChannelSlot(channel.(*model.Channel))
+		c.Set(ctxkey.ChannelSlot, nil)
+	}
+}
+
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.ChannelId, channel.Id)
@@ -70,7 +150,10 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Set(ctxkey.MaxContext, channel.GetMaxContext(modelName))
+	key := model.PickChannelKey(channel, c.GetString(ctxkey.Affinity))
+	c.Set(ctxkey.ChannelKey, key)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	cfg, _ := channel.LoadConfig()
 	// this is for backward compatibility
@@ -100,3 +183,92 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.Config, cfg)
 }
+
+// getAffinityKey returns what the requests of a session share for sticky routing, "" if the request
+// has none of the configured sources.
+func getAffinityKey(c *gin.Context) string {
+	if config.StickyRoutingKey == "" {
+		return ""
+	}
+	var request struct {
+		User     string            `json:"user"`
+		System   json.RawMessage   `json:"system"`
+		Messages []json.RawMessage `json:"messages"`
+		Contents []json.RawMessage `json:"contents"`
+	}
+	if c.ContentType() == "application/json" {
+		_ = common.UnmarshalBodyReusable(c, &request)
+	}
+	for _, source := range strings.Split(config.StickyRoutingKey, ",") {
+		switch strings.TrimSpace(source) {
+		case "session":
+			if session := c.Request.Header.Get("X-Session-Id"); session != "" {
+				return "session:" + session
+			}
+		case "user":
+			if request.User != "" {
+				return "user:" + request.User
+			}
+		case "messages":
+			messages := request.Messages
+			if len(messages) == 0 {
+				// the Gemini format
+				messages = request.Contents
+			}
+			if len(messages) == 0 {
+				continue
+			}
+			hash := sha256.New()
+			hash.Write(request.System)
+			for _, message := range messages[:min(len(messages), config.StickyRoutingMessages)] {
+				hash.Write(message)
+			}
+			return "messages:" + hex.EncodeToString(hash.Sum(nil))
+		case "token":
+			return "token:" + strconv.Itoa(c.GetInt(ctxkey.TokenId))
+		}
+	}
+	return ""
+}
+
+// GetFallbackModels returns the fallback chain of the model for the group of the user, leaving out
+// the models the token may not use. A request can only be switched to another model when the model
+// is part of its JSON body.
+func GetFallbackModels(c *gin.Context, modelName string) []string {
+	if c.ContentType() != "application/json" {
+		return nil
+	}
+	availableModels := c.GetString(ctxkey.AvailableModels)
+	var fallbacks []string
+	for _, fallback := range model.GetModelFallbacks(c.GetString(ctxkey.Group), modelName) {
+		if availableModels != "" && !isModelInList(fallback, availableModels) {
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks
+}
+
+// SetRequestModel replaces the model in the request body by the model the request is served with.
+func SetRequestModel(c *gin.Context, modelName string) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]json.RawMessage
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return err
+	}
+	request["model"], err = json.Marshal(modelName)
+	if err != nil {
+		return err
+	}
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Set(ctxkey.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return nil
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestDistributeChannelSlots(t *testing.T) {
+	Convey("Distribute", t, func() {
+		gin.SetMode(gin.TestMode)
+		var err error
+		model.DB, err = gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		So(err, ShouldBeNil)
+		So(model.DB.AutoMigrate(&model.User{}, &model.Channel{}, &model.Ability{}), ShouldBeNil)
+		common.UsingSQLite = true
+		common.RedisEnabled = false
+		config.MemoryCacheEnabled = false
+		So(model.DB.Create(&model.User{Id: 1, Username: "test", Password: "12345678", Group: "default"}).Error, ShouldBeNil)
+		maxConcurrency, queueTimeout := 1, 1
+		for id, models := range map[int]string{1: "gpt-4o", 2: "gpt-4o", 3: "gpt-4o-mini"} {
+			channel := &model.Channel{Id: id, Status: model.ChannelStatusEnabled, Key: "sk-test", Models: models, Group: "default",
+				MaxConcurrency: &maxConcurrency, QueueTimeout: &queueTimeout}
+			So(model.DB.Create(channel).Error, ShouldBeNil)
+			So(channel.AddAbilities(), ShouldBeNil)
+		}
+		serve := func(modelName string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+			engine := gin.New()
+			engine.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}))
+			engine.POST("/v1/chat/completions", func(c *gin.Context) {
+				c.Set(ctxkey.Id, 1)
+				c.Set(ctxkey.RequestModel, modelName)
+			}, Distribute(), handler)
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+modelName+`"}`))
+			request.Header.Set("Content-Type", "application/json")
+			engine.ServeHTTP(w, request)
+			return w
+		}
+		hold := func(modelName string) *model.Channel {
+			channel, err := model.CacheGetRandomSatisfiedChannel("default", modelName, false, 0)
+			if err != nil {
+				return nil
+			}
+			return channel
+		}
+		// free tells how many channels of the model have a free slot
+		free := func(modelName string) int {
+			var held []*model.Channel
+			for channel := hold(modelName); channel != nil; channel = hold(modelName) {
+				held = append(held, channel)
+			}
+			for _, channel := range held {
+				model.ReleaseChannelSlot(channel)
+			}
+			return len(held)
+		}
+
+		Convey("answers 429 once the channels stay full for the queue timeout", func() {
+			first, second := hold("gpt-4o"), hold("gpt-4o")
+			defer model.ReleaseChannelSlot(first)
+			defer model.ReleaseChannelSlot(second)
+			start := time.Now()
+			w := serve("gpt-4o", func(c *gin.Context) { c.Status(http.StatusOK) })
+			So(w.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Second)
+		})
+
+		Convey("waits for a busy model rather than falling back", func() {
+			So(model.UpdateModelFallbacksByJSONString(`{"default": {"gpt-4o": ["gpt-4o-mini"]}}`), ShouldBeNil)
+			defer func() { So(model.UpdateModelFallbacksByJSONString(`{}`), ShouldBeNil) }()
+			first, second := hold("gpt-4o"), hold("gpt-4o")
+			defer model.ReleaseChannelSlot(second)
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				model.ReleaseChannelSlot(first)
+			}()
+			w := serve("gpt-4o", func(c *gin.Context) {
+				So(c.GetInt(ctxkey.ChannelId), ShouldEqual, first.Id)
+				So(c.GetString(ctxkey.FallbackModel), ShouldBeEmpty)
+				c.Status(http.StatusOK)
+			})
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("gives back the slot of the channel left for a retry", func() {
+			w := serve("gpt-4o", func(c *gin.Context) {
+				So(free("gpt-4o"), ShouldEqual, 1)
+				retryChannel := hold("gpt-4o")
+				So(retryChannel.Id, ShouldNotEqual, c.GetInt(ctxkey.ChannelId))
+				HoldChannelSlot(c, retryChannel)
+				So(free("gpt-4o"), ShouldEqual, 1)
+				c.Status(http.StatusOK)
+			})
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(free("gpt-4o"), ShouldEqual, 2)
+		})
+
+		Convey("gives back the slot of the channel left for a fallback model", func() {
+			w := serve("gpt-4o", func(c *gin.Context) {
+				HoldChannelSlot(c, hold("gpt-4o-mini"))
+				So(free("gpt-4o"), ShouldEqual, 2)
+				So(free("gpt-4o-mini"), ShouldEqual, 0)
+				c.Status(http.StatusOK)
+			})
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(free("gpt-4o-mini"), ShouldEqual, 1)
+		})
+
+		Convey("gives back the slot when the relay panics", func() {
+			w := serve("gpt-4o", func(c *gin.Context) {
+				panic("relay failed")
+			})
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(free("gpt-4o"), ShouldEqual, 2)
+		})
+	})
+}
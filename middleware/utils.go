@@ -26,6 +26,10 @@ func getRequestModel(c *gin.Context) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("common.UnmarshalBodyReusable failed: %w", err)
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// gemini puts the model into the path: /v1beta/models/{model}:generateContent
+		modelRequest.Model, _, _ = strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/v1beta/models/"), ":")
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "text-moderation-stable"
@@ -36,7 +40,7 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
@@ -17,10 +17,28 @@ type Ability struct {
 	ChannelId int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false;index"`
 	Enabled   bool   `json:"enabled"`
 	Priority  *int64 `json:"priority" gorm:"bigint;default:0;index"`
+	Weight    uint   `json:"weight" gorm:"default:0"`
 }
 
-func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
-	ability := Ability{}
+// getSatisfiedChannels returns the enabled channels of the model in the group.
+func getSatisfiedChannels(group string, model string) ([]*Channel, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var channelIds []int
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var channels []*Channel
+	err = DB.Where("id in ?", channelIds).Find(&channels).Error
+	return channels, err
+}
+
+func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool, promptTokens int) (*Channel, error) {
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -30,24 +48,72 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 
 	var err error = nil
 	var channelQuery *gorm.DB
+	condition := groupCol + " = ? and model = ? and enabled = " + trueVal
+	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(condition, group, model)
 	if ignoreFirstPriority {
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+		// the channels below the highest priority, like the cache does, or those of the highest if
+		// there is only one priority
+		lowerPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(condition+" and priority < (?)", group, model, maxPrioritySubQuery)
+		channelQuery = DB.Where(condition+" and priority <= COALESCE((?), (?))", group, model, lowerPrioritySubQuery, maxPrioritySubQuery)
 	} else {
-		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+		channelQuery = DB.Where(condition+" and priority = (?)", group, model, maxPrioritySubQuery)
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
+	// the candidates are picked by weight here rather than in SQL, their weights are adjusted by
+	// the stats of the channels and the full ones are skipped
+	var abilities []Ability
+	err = channelQuery.Find(&abilities).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(abilities) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	channelIds := make([]int, len(abilities))
+	for i := range abilities {
+		channelIds[i] = abilities[i].ChannelId
 	}
+	var tierChannels []*Channel
+	err = DB.Where("id in ?", channelIds).Find(&tierChannels).Error
 	if err != nil {
 		return nil, err
 	}
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	channelsById := make(map[int]*Channel, len(tierChannels))
+	for _, channel := range tierChannels {
+		channelsById[channel.Id] = channel
+	}
+	candidates := make([]*Channel, 0, len(abilities))
+	weights := make([]uint, 0, len(abilities))
+	for i := range abilities {
+		if channel, ok := channelsById[abilities[i].ChannelId]; ok {
+			candidates = append(candidates, channel)
+			weights = append(weights, abilities[i].Weight)
+		}
+	}
+	if len(candidates) == 0 {
+		return &Channel{Id: abilities[0].ChannelId}, gorm.ErrRecordNotFound
+	}
+	channelIds = channelIds[:0]
+	for _, channel := range candidates {
+		channelIds = append(channelIds, channel.Id)
+	}
+	weights = balanceWeights(channelIds, weights, model)
+	idx, busy := pickChannel(candidates, weights, model, promptTokens)
+	if idx >= 0 {
+		return candidates[idx], nil
+	}
+	// the channels are all full or their circuit breakers are open, try those of the other priorities
+	if !ignoreFirstPriority {
+		channel, err := GetRandomSatisfiedChannel(group, model, true, promptTokens)
+		if err != nil && busy != nil {
+			otherBusy, _ := err.(*ChannelBusyError)
+			return nil, busy.merge(otherBusy)
+		}
+		return channel, err
+	}
+	if busy != nil {
+		return nil, busy
+	}
+	return nil, gorm.ErrRecordNotFound
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -63,6 +129,7 @@ func (channel *Channel) AddAbilities() error {
 				ChannelId: channel.Id,
 				Enabled:   channel.Status == ChannelStatusEnabled,
 				Priority:  channel.Priority,
+				Weight:    channel.GetWeight(),
 			}
 			abilities = append(abilities, ability)
 		}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const weightTestPicks = 10000
+
+func setupWeightTestChannels(weights []uint, priorities []int64) {
+	var err error
+	DB, err = gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	So(err, ShouldBeNil)
+	So(DB.AutoMigrate(&Channel{}, &Ability{}), ShouldBeNil)
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	for i := range weights {
+		channel := &Channel{
+			Id:       i + 1,
+			Status:   ChannelStatusEnabled,
+			Models:   "gpt-4o",
+			Group:    "default",
+			Weight:   &weights[i],
+			Priority: &priorities[i],
+		}
+		So(DB.Create(channel).Error, ShouldBeNil)
+		So(channel.AddAbilities(), ShouldBeNil)
+	}
+}
+
+func countPicks(pick func() (*Channel, error)) map[int]int {
+	counts := make(map[int]int)
+	var err error
+	for i := 0; i < weightTestPicks && err == nil; i++ {
+		var channel *Channel
+		channel, err = pick()
+		if err == nil {
+			counts[channel.Id]++
+		}
+	}
+	So(err, ShouldBeNil)
+	return counts
+}
+
+func shouldBeShareOf(counts map[int]int, id int, share float64) {
+	So(float64(counts[id])/weightTestPicks, ShouldAlmostEqual, share, 0.03)
+}
+
+func TestWeightedChannelSelection(t *testing.T) {
+	for _, memoryCacheEnabled := range []bool{true, false} {
+		name := "database"
+		if memoryCacheEnabled {
+			name = "memory cache"
+		}
+		Convey("weighted selection with "+name, t, func() {
+			config.MemoryCacheEnabled = memoryCacheEnabled
+			defer func() { config.MemoryCacheEnabled = false }()
+			pick := func(ignoreFirstPriority bool) func() (*Channel, error) {
+				return func() (*Channel, error) {
+					return CacheGetRandomSatisfiedChannel("default", "gpt-4o", ignoreFirstPriority, 0)
+				}
+			}
+
+			Convey("channels are picked in proportion to their weights", func() {
+				setupWeightTestChannels([]uint{1, 3}, []int64{0, 0})
+				InitChannelCache()
+				counts := countPicks(pick(false))
+				shouldBeShareOf(counts, 1, 0.25)
+				shouldBeShareOf(counts, 2, 0.75)
+			})
+
+			Convey("zero weights are picked uniformly", func() {
+				setupWeightTestChannels([]uint{0, 0, 0, 0}, []int64{0, 0, 0, 0})
+				InitChannelCache()
+				counts := countPicks(pick(false))
+				for id := 1; id <= 4; id++ {
+					shouldBeShareOf(counts, id, 0.25)
+				}
+			})
+
+			Convey("a zero weight counts as one among weighted channels", func() {
+				setupWeightTestChannels([]uint{0, 4}, []int64{0, 0})
+				InitChannelCache()
+				counts := countPicks(pick(false))
+				shouldBeShareOf(counts, 1, 0.2)
+				shouldBeShareOf(counts, 2, 0.8)
+			})
+
+			Convey("weights only apply within a priority", func() {
+				setupWeightTestChannels([]uint{1, 1, 9, 1, 3}, []int64{10, 10, 5, 1, 1})
+				InitChannelCache()
+				counts := countPicks(pick(false))
+				So(counts[3]+counts[4]+counts[5], ShouldEqual, 0)
+				shouldBeShareOf(counts, 1, 0.5)
+				shouldBeShareOf(counts, 2, 0.5)
+
+				// a retry goes to all the lower priorities at once
+				counts = countPicks(pick(true))
+				So(counts[1]+counts[2], ShouldEqual, 0)
+				shouldBeShareOf(counts, 3, 9.0/13)
+				shouldBeShareOf(counts, 4, 1.0/13)
+				shouldBeShareOf(counts, 5, 3.0/13)
+			})
+
+			Convey("channels with a shorter context than the prompt are skipped", func() {
+				setupWeightTestChannels([]uint{1, 1}, []int64{10, 0})
+				So(DB.Model(&Channel{}).Where("id = ?", 1).Update("max_context", 32000).Error, ShouldBeNil)
+				InitChannelCache()
+				maxContext, limited := CacheGetMaxContext("default", "gpt-4o")
+				So(limited, ShouldBeTrue)
+				So(maxContext, ShouldEqual, 0)
+				channel, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false, 150000)
+				So(err, ShouldBeNil)
+				So(channel.Id, ShouldEqual, 2)
+				channel, err = CacheGetRandomSatisfiedChannel("default", "gpt-4o", false, 1000)
+				So(err, ShouldBeNil)
+				So(channel.Id, ShouldEqual, 1)
+			})
+		})
+	}
+}
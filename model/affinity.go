@@ -0,0 +1,84 @@
+package model
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Sticky routing sends the requests sharing an affinity key, e.g. those of a session, to the same
+// channel and key so that the prompt cache of the upstream gets hit. The channel is chosen by
+// rendezvous hashing, adding or removing a channel only moves the sessions it gains or loses.
+
+// rendezvousScore rates a candidate for the affinity key, the candidate with the highest score wins.
+// The scores are weighted so that each candidate gets its share of the keys.
+func rendezvousScore(affinity string, candidate string, weight uint) float64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(affinity))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(candidate))
+	// fnv hardly mixes the last bytes into the high bits, the finalizer of splitmix64 does
+	x := hash.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	// a uniform number in (0, 1)
+	u := (float64(x>>11) + 0.5) / (1 << 53)
+	return -float64(max(weight, 1)) / math.Log(u)
+}
+
+// rendezvousIndex returns the index of the candidate the affinity key hashes to.
+func rendezvousIndex(affinity string, candidates []string, weights []uint) int {
+	best, bestScore := 0, math.Inf(-1)
+	for i, candidate := range candidates {
+		if score := rendezvousScore(affinity, candidate, weights[i]); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// CacheGetStickyChannel picks the channel the affinity key hashes to among the channels of the
+// highest priority and takes a slot of it. It fails if that channel cannot take the request right
+// now, the request is then sent to a channel picked as usual.
+func CacheGetStickyChannel(group string, model string, affinity string, promptTokens int) (*Channel, error) {
+	var channels []*Channel
+	if config.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels = append(channels, group2model2channels[group][model]...)
+		channelSyncLock.RUnlock()
+	} else {
+		var err error
+		channels, err = getSatisfiedChannels(group, model)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(channels, func(i, j int) bool {
+			return channels[i].GetPriority() > channels[j].GetPriority()
+		})
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	var candidates []string
+	var weights []uint
+	for _, channel := range channels {
+		if channel.GetPriority() != channels[0].GetPriority() {
+			break
+		}
+		candidates = append(candidates, strconv.Itoa(channel.Id))
+		weights = append(weights, channel.GetWeight())
+	}
+	channel := channels[rendezvousIndex(affinity, candidates, weights)]
+	if idx, busy := pickChannel([]*Channel{channel}, []uint{1}, model, promptTokens); idx < 0 {
+		if busy != nil {
+			return nil, busy
+		}
+		return nil, errors.New("channel not available")
+	}
+	return channel, nil
+}
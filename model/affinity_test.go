@@ -0,0 +1,34 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRendezvousIndex(t *testing.T) {
+	Convey("rendezvousIndex", t, func() {
+		candidates := []string{"1", "2", "3", "4"}
+		weights := []uint{1, 1, 1, 1}
+
+		Convey("only moves the keys of a removed candidate", func() {
+			for i := 0; i < 1000; i++ {
+				affinity := fmt.Sprintf("session:%d", i)
+				before := candidates[rendezvousIndex(affinity, candidates, weights)]
+				after := candidates[:3][rendezvousIndex(affinity, candidates[:3], weights[:3])]
+				if before != "4" {
+					So(after, ShouldEqual, before)
+				}
+			}
+		})
+
+		Convey("shares the keys by weight", func() {
+			counts := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				counts[candidates[rendezvousIndex(fmt.Sprintf("session:%d", i), candidates[:2], []uint{1, 3})]]++
+			}
+			So(counts["2"], ShouldBeBetween, 7000, 8000)
+		})
+	})
+}
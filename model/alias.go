@@ -0,0 +1,134 @@
+package model
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelAliases maps the names clients may ask for to the models serving them in every group, e.g.
+// {"gpt-4-latest": "gpt-4o-2024-08-06"}. The alias is replaced before picking a channel.
+var ModelAliases = map[string]string{}
+var modelAliasesLock sync.RWMutex
+
+func ModelAliases2JSONString() string {
+	modelAliasesLock.RLock()
+	defer modelAliasesLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelAliases)
+	if err != nil {
+		logger.SysError("error marshalling model aliases: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelAliasesByJSONString(jsonStr string) error {
+	aliases := make(map[string]string)
+	err := json.Unmarshal([]byte(jsonStr), &aliases)
+	if err != nil {
+		return err
+	}
+	modelAliasesLock.Lock()
+	defer modelAliasesLock.Unlock()
+	ModelAliases = aliases
+	return nil
+}
+
+// GetModelAlias returns the model the alias stands for, false if the name is not an alias.
+func GetModelAlias(alias string) (string, bool) {
+	modelAliasesLock.RLock()
+	defer modelAliasesLock.RUnlock()
+	modelName := ModelAliases[alias]
+	if modelName == "" || modelName == alias {
+		return alias, false
+	}
+	return modelName, true
+}
+
+// GetModelAliases returns the aliases sorted by name.
+func GetModelAliases() (aliases []string, modelNames []string) {
+	modelAliasesLock.RLock()
+	defer modelAliasesLock.RUnlock()
+	for alias, modelName := range ModelAliases {
+		if modelName != "" && modelName != alias {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		modelNames = append(modelNames, ModelAliases[alias])
+	}
+	return aliases, modelNames
+}
+
+// regexModelPrefix marks a regular expression in the model mapping of a channel
+const regexModelPrefix = "regex:"
+
+var modelPatterns sync.Map
+
+// getModelPattern compiles a key of the model mapping which is a pattern, nil if it is a plain name
+// or an invalid pattern. A wildcard * matches any part of the name, the part it matches replaces the
+// * at the same place in the mapped name. A regular expression starts with regex: and its groups may
+// be used in the mapped name as $1, $2 and so on.
+func getModelPattern(key string) *regexp.Regexp {
+	if !strings.HasPrefix(key, regexModelPrefix) && !strings.Contains(key, "*") {
+		return nil
+	}
+	if pattern, ok := modelPatterns.Load(key); ok {
+		return pattern.(*regexp.Regexp)
+	}
+	var expr string
+	if strings.HasPrefix(key, regexModelPrefix) {
+		expr = strings.TrimPrefix(key, regexModelPrefix)
+	} else {
+		expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(key), `\*`, "(.*)") + "$"
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		logger.SysError("invalid model mapping pattern " + key + ": " + err.Error())
+	}
+	modelPatterns.Store(key, pattern)
+	return pattern
+}
+
+// MapModelName maps the model name with the model mapping of a channel, an exact match first and
+// then the longest matching pattern.
+func MapModelName(modelName string, mapping map[string]string) (string, bool) {
+	if mapping == nil {
+		return modelName, false
+	}
+	if mappedModelName := mapping[modelName]; mappedModelName != "" {
+		return mappedModelName, true
+	}
+	var keys []string
+	for key, mappedModelName := range mapping {
+		if mappedModelName != "" && getModelPattern(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		pattern := getModelPattern(key)
+		match := pattern.FindStringSubmatchIndex(modelName)
+		if match == nil {
+			continue
+		}
+		if strings.HasPrefix(key, regexModelPrefix) {
+			return string(pattern.ExpandString(nil, mapping[key], modelName, match)), true
+		}
+		mappedModelName := mapping[key]
+		for i := 1; i < len(match)/2; i++ {
+			mappedModelName = strings.Replace(mappedModelName, "*", modelName[match[2*i]:match[2*i+1]], 1)
+		}
+		return mappedModelName, true
+	}
+	return modelName, false
+}
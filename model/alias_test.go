@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMapModelName(t *testing.T) {
+	Convey("MapModelName", t, func() {
+		mapping := map[string]string{
+			"gpt-4":                      "gpt-4o",
+			"claude-*":                   "anthropic.claude-*",
+			"claude-3-5-*":               "anthropic.claude-3-5-*-v2:0",
+			"regex:^qwen-(\\w+)-(\\d+)$": "qwen-${1}-latest-$2",
+			"regex:[":                    "broken",
+		}
+
+		Convey("prefers the exact match", func() {
+			modelName, mapped := MapModelName("gpt-4", mapping)
+			So(mapped, ShouldBeTrue)
+			So(modelName, ShouldEqual, "gpt-4o")
+		})
+
+		Convey("replaces the wildcard with the part it matches", func() {
+			modelName, mapped := MapModelName("claude-3-opus", mapping)
+			So(mapped, ShouldBeTrue)
+			So(modelName, ShouldEqual, "anthropic.claude-3-opus")
+		})
+
+		Convey("prefers the longest pattern", func() {
+			modelName, _ := MapModelName("claude-3-5-sonnet", mapping)
+			So(modelName, ShouldEqual, "anthropic.claude-3-5-sonnet-v2:0")
+		})
+
+		Convey("expands the groups of a regular expression", func() {
+			modelName, mapped := MapModelName("qwen-max-2", mapping)
+			So(mapped, ShouldBeTrue)
+			So(modelName, ShouldEqual, "qwen-max-latest-2")
+		})
+
+		Convey("keeps the names nothing matches", func() {
+			modelName, mapped := MapModelName("gpt-4o-mini", mapping)
+			So(mapped, ShouldBeFalse)
+			So(modelName, ShouldEqual, "gpt-4o-mini")
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// Adaptive balancing keeps rolling statistics of the channels and models served by this node, and
+// scales the weights of the channels of a priority by their health so that slow or flaky channels
+// get less traffic long before the monitor disables them.
+
+const (
+	// balanceAlpha is the weight of the newest sample in the moving averages
+	balanceAlpha = 0.1
+	// minHealthScore keeps some traffic on unhealthy channels to notice when they recover
+	minHealthScore = 0.05
+	// latencyWindow is how many of the latest latencies are kept for the percentiles
+	latencyWindow = 100
+	// minLatencySamples is how many latencies a percentile needs to mean anything
+	minLatencySamples = 10
+)
+
+type ChannelStats struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+	Requests  int64  `json:"requests"`
+	Errors    int64  `json:"errors"`
+	// ErrorRate, Latency and FirstTokenLatency are moving averages, latencies are in ms
+	ErrorRate         float64 `json:"error_rate"`
+	Latency           float64 `json:"latency"`
+	FirstTokenLatency float64 `json:"first_token_latency"`
+	UpdatedAt         int64   `json:"updated_at"`
+
+	latencySamples    int64
+	firstTokenSamples int64
+	latencies         []float64
+}
+
+type channelStatsKey struct {
+	channelId int
+	model     string
+}
+
+var channelStats = make(map[channelStatsKey]*ChannelStats)
+var channelStatsLock sync.Mutex
+
+func movingAverage(average float64, sample float64, samples int64) float64 {
+	if samples == 0 {
+		return sample
+	}
+	return average + balanceAlpha*(sample-average)
+}
+
+// RecordChannelRequest feeds the outcome of a relayed request into the statistics, firstToken is
+// zero unless the response is a stream.
+func RecordChannelRequest(channelId int, modelName string, success bool, latency time.Duration, firstToken time.Duration) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	key := channelStatsKey{channelId: channelId, model: modelName}
+	stats, ok := channelStats[key]
+	if !ok {
+		stats = &ChannelStats{ChannelId: channelId, Model: modelName}
+		channelStats[key] = stats
+	}
+	errorSample := 0.0
+	if !success {
+		errorSample = 1
+		stats.Errors++
+	}
+	stats.ErrorRate = movingAverage(stats.ErrorRate, errorSample, stats.Requests)
+	stats.Requests++
+	stats.UpdatedAt = helper.GetTimestamp()
+	// failed requests tend to return early, their latency says nothing about the channel
+	if !success {
+		return
+	}
+	stats.Latency = movingAverage(stats.Latency, float64(latency.Milliseconds()), stats.latencySamples)
+	if len(stats.latencies) < latencyWindow {
+		stats.latencies = append(stats.latencies, float64(latency.Milliseconds()))
+	} else {
+		stats.latencies[stats.latencySamples%latencyWindow] = float64(latency.Milliseconds())
+	}
+	stats.latencySamples++
+	if firstToken > 0 {
+		stats.FirstTokenLatency = movingAverage(stats.FirstTokenLatency, float64(firstToken.Milliseconds()), stats.firstTokenSamples)
+		stats.firstTokenSamples++
+	}
+}
+
+// ChannelLatencyPercentile returns the latency of the channel for the model at the percentile of its
+// latest requests, false if the channel has not served enough of them yet.
+func ChannelLatencyPercentile(channelId int, modelName string, percentile float64) (time.Duration, bool) {
+	channelStatsLock.Lock()
+	stats := channelStats[channelStatsKey{channelId: channelId, model: modelName}]
+	if stats == nil || len(stats.latencies) < minLatencySamples {
+		channelStatsLock.Unlock()
+		return 0, false
+	}
+	latencies := append([]float64(nil), stats.latencies...)
+	channelStatsLock.Unlock()
+	sort.Float64s(latencies)
+	i := int(math.Ceil(percentile/100*float64(len(latencies)))) - 1
+	i = min(max(i, 0), len(latencies)-1)
+	return time.Duration(latencies[i]) * time.Millisecond, true
+}
+
+func GetAllChannelStats() []ChannelStats {
+	channelStatsLock.Lock()
+	all := make([]ChannelStats, 0, len(channelStats))
+	for _, stats := range channelStats {
+		all = append(all, *stats)
+	}
+	channelStatsLock.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].ChannelId != all[j].ChannelId {
+			return all[i].ChannelId < all[j].ChannelId
+		}
+		return all[i].Model < all[j].Model
+	})
+	return all
+}
+
+// channelHealthScores rates the candidates of a priority against each other. The latency of a
+// channel is compared to the fastest candidate, by time to first token when both streamed.
+func channelHealthScores(channelIds []int, modelName string) []float64 {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	candidates := make([]*ChannelStats, len(channelIds))
+	bestLatency, bestFirstToken := math.MaxFloat64, math.MaxFloat64
+	for i, channelId := range channelIds {
+		stats := channelStats[channelStatsKey{channelId: channelId, model: modelName}]
+		if stats == nil {
+			continue
+		}
+		candidates[i] = stats
+		if stats.latencySamples > 0 {
+			bestLatency = min(bestLatency, stats.Latency)
+		}
+		if stats.firstTokenSamples > 0 {
+			bestFirstToken = min(bestFirstToken, stats.FirstTokenLatency)
+		}
+	}
+	scores := make([]float64, len(channelIds))
+	for i, stats := range candidates {
+		// channels without statistics are assumed healthy so that they get explored
+		score := 1.0
+		if stats != nil {
+			score = (1 - stats.ErrorRate) * (1 - stats.ErrorRate)
+			switch {
+			case stats.firstTokenSamples > 0 && stats.FirstTokenLatency > 0:
+				score *= bestFirstToken / stats.FirstTokenLatency
+			case stats.latencySamples > 0 && stats.Latency > 0:
+				score *= bestLatency / stats.Latency
+			}
+		}
+		scores[i] = max(score, minHealthScore)
+	}
+	return scores
+}
+
+// balanceWeights scales the weights of the candidates by their health when adaptive balancing is enabled.
+func balanceWeights(channelIds []int, weights []uint, modelName string) []uint {
+	if !config.AdaptiveBalancingEnabled {
+		return weights
+	}
+	scores := channelHealthScores(channelIds, modelName)
+	for i := range weights {
+		weights[i] = uint(math.Max(1, math.Round(float64(max(weights[i], 1))*scores[i]*1000)))
+	}
+	return weights
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusCompleted  = "completed"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+	BatchStatusExpired    = "expired"
+)
+
+// Batch is a job of the batch API, its lines are executed by the batch worker of the master node.
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id"`
+	Endpoint         string `json:"endpoint"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window"`
+	Status           string `json:"status" gorm:"type:varchar(32);index"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64);default:''"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64);default:''"`
+	Errors           string `json:"errors" gorm:"type:text"`   // validation errors in json
+	Metadata         string `json:"metadata" gorm:"type:text"` // json
+	TotalCount       int    `json:"total_count" gorm:"default:0"`
+	CompletedCount   int    `json:"completed_count" gorm:"default:0"`
+	FailedCount      int    `json:"failed_count" gorm:"default:0"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (b *Batch) Insert() error {
+	return DB.Create(b).Error
+}
+
+func GetBatchById(id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	batch := Batch{}
+	err := DB.First(&batch, "id = ?", id).Error
+	return &batch, err
+}
+
+func GetUserBatchById(id string, userId int) (*Batch, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	batch := Batch{}
+	err := DB.First(&batch, "id = ? and user_id = ?", id, userId).Error
+	return &batch, err
+}
+
+// GetUserBatches returns batches created before the one with id after, newest first.
+func GetUserBatches(userId int, after string, limit int) (batches []*Batch, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		batch, err := GetUserBatchById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("created_at < ? or (created_at = ? and id < ?)", batch.CreatedAt, batch.CreatedAt, batch.Id)
+	}
+	err = tx.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnfinishedBatches returns the batches the worker still has to work on.
+func GetUnfinishedBatches() (batches []*Batch, err error) {
+	err = DB.Where("status in ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusCancelling}).Find(&batches).Error
+	return batches, err
+}
+
+// UpdateBatchStatus moves the batch to status only if it is still in one of the from statuses,
+// so that a concurrent cancellation is never overwritten.
+func UpdateBatchStatus(id string, from []string, status string, fields map[string]any) (bool, error) {
+	updates := map[string]any{"status": status}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := DB.Model(&Batch{}).Where("id = ? and status in ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+func CancelBatch(id string, userId int) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? and user_id = ? and status in ?", id, userId, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": helper.GetTimestamp()})
+	return result.RowsAffected > 0, result.Error
+}
+
+func UpdateBatchProgress(id string, completedCount int, failedCount int) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(map[string]any{
+		"completed_count": completedCount,
+		"failed_count":    failedCount,
+	}).Error
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// The circuit breaker of a channel and model opens after consecutive channel errors so that the
+// channel is skipped when picking channels. Once the cooldown has passed it is half-open and lets a
+// few requests through as probes, the first success closes it and a failure opens it again.
+// The state is kept in Redis when it is enabled so that all nodes share it.
+
+const (
+	CircuitClosed   = 0
+	CircuitOpen     = 1
+	CircuitHalfOpen = 2
+)
+
+type circuitBreaker struct {
+	state    int
+	failures int
+	// since is when the breaker opened, or when the current probes were let through in half-open state
+	since  int64
+	probes int
+}
+
+// acquire tells whether a request may be sent, counting it as a probe in half-open state.
+func (b *circuitBreaker) acquire(now int64, cooldown int64, maxProbes int) bool {
+	switch b.state {
+	case CircuitOpen:
+		if now < b.since+cooldown {
+			return false
+		}
+		b.state, b.since, b.probes = CircuitHalfOpen, now, 1
+		return true
+	case CircuitHalfOpen:
+		// probes which never reported back are given up after another cooldown
+		if now >= b.since+cooldown {
+			b.since, b.probes = now, 1
+			return true
+		}
+		if b.probes >= maxProbes {
+			return false
+		}
+		b.probes++
+		return true
+	}
+	return true
+}
+
+// release gives back a probe which was not sent.
+func (b *circuitBreaker) release() {
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// onFailure returns true if the breaker has just opened.
+func (b *circuitBreaker) onFailure(now int64, threshold int) bool {
+	switch b.state {
+	case CircuitOpen:
+		return false
+	case CircuitClosed:
+		b.failures++
+		if b.failures < threshold {
+			return false
+		}
+	}
+	b.state, b.since, b.probes = CircuitOpen, now, 0
+	return true
+}
+
+var circuitBreakers = make(map[channelStatsKey]*circuitBreaker)
+var circuitBreakersLock sync.Mutex
+
+func circuitBreakerKey(channelId int, modelName string) string {
+	return fmt.Sprintf("circuit_breaker:%d:%s", channelId, modelName)
+}
+
+// circuitBreakerExpiration drops the failures of a channel which has been quiet for a while
+func circuitBreakerExpiration() int64 {
+	return max(int64(config.CircuitBreakerCooldown)*10, 3600) * 1000
+}
+
+var acquireCircuitScript = redis.NewScript(`
+local state = tonumber(redis.call('HGET', KEYS[1], 'state') or '0')
+if state == 0 then
+	return 1
+end
+local now, cooldown, maxProbes = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local since = tonumber(redis.call('HGET', KEYS[1], 'since') or '0')
+if state == 1 then
+	if now < since + cooldown then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'state', 2, 'since', now, 'probes', 1)
+elseif now >= since + cooldown then
+	redis.call('HSET', KEYS[1], 'since', now, 'probes', 1)
+else
+	local probes = tonumber(redis.call('HGET', KEYS[1], 'probes') or '0')
+	if probes >= maxProbes then
+		return 0
+	end
+	redis.call('HINCRBY', KEYS[1], 'probes', 1)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+var releaseCircuitProbeScript = redis.NewScript(`
+local state = tonumber(redis.call('HGET', KEYS[1], 'state') or '0')
+local probes = tonumber(redis.call('HGET', KEYS[1], 'probes') or '0')
+if state == 2 and probes > 0 then
+	redis.call('HINCRBY', KEYS[1], 'probes', -1)
+end
+return 1
+`)
+
+var circuitSuccessScript = redis.NewScript(`
+local state = tonumber(redis.call('HGET', KEYS[1], 'state') or '0')
+if state ~= 1 then
+	redis.call('DEL', KEYS[1])
+end
+return state
+`)
+
+var circuitFailureScript = redis.NewScript(`
+local state = tonumber(redis.call('HGET', KEYS[1], 'state') or '0')
+if state == 1 then
+	return 0
+end
+if state == 0 then
+	local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+	if failures < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[1], ARGV[3])
+		return 0
+	end
+end
+redis.call('HSET', KEYS[1], 'state', 1, 'since', ARGV[1], 'probes', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// acquireCircuit tells whether the circuit breaker of the channel and model lets a request through.
+func acquireCircuit(channelId int, modelName string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+	now := time.Now().UnixMilli()
+	cooldown := int64(config.CircuitBreakerCooldown) * 1000
+	if common.RedisEnabled {
+		allowed, err := acquireCircuitScript.Run(context.Background(), common.RDB, []string{circuitBreakerKey(channelId, modelName)},
+			now, cooldown, config.CircuitBreakerHalfOpenRequests, circuitBreakerExpiration()).Int()
+		if err != nil {
+			logger.SysError("failed to check circuit breaker: " + err.Error())
+			return true
+		}
+		return allowed == 1
+	}
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	breaker, ok := circuitBreakers[channelStatsKey{channelId: channelId, model: modelName}]
+	if !ok {
+		return true
+	}
+	return breaker.acquire(now, cooldown, config.CircuitBreakerHalfOpenRequests)
+}
+
+// ReleaseCircuitProbe gives back the probe taken when the channel was picked for a request which was
+// not sent, so that a half-open breaker does not wait for its result.
+func ReleaseCircuitProbe(channelId int, modelName string) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+	if common.RedisEnabled {
+		err := releaseCircuitProbeScript.Run(context.Background(), common.RDB, []string{circuitBreakerKey(channelId, modelName)}).Err()
+		if err != nil {
+			logger.SysError("failed to release circuit breaker probe: " + err.Error())
+		}
+		return
+	}
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	if breaker, ok := circuitBreakers[channelStatsKey{channelId: channelId, model: modelName}]; ok {
+		breaker.release()
+	}
+}
+
+// RecordCircuitResult feeds the outcome of a request sent to the channel into its circuit breaker.
+func RecordCircuitResult(channelId int, modelName string, success bool) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+	if success {
+		recordCircuitSuccess(channelId, modelName)
+	} else {
+		recordCircuitFailure(channelId, modelName)
+	}
+}
+
+func recordCircuitSuccess(channelId int, modelName string) {
+	previousState := CircuitClosed
+	if common.RedisEnabled {
+		state, err := circuitSuccessScript.Run(context.Background(), common.RDB, []string{circuitBreakerKey(channelId, modelName)}).Int()
+		if err != nil {
+			logger.SysError("failed to update circuit breaker: " + err.Error())
+			return
+		}
+		previousState = state
+	} else {
+		circuitBreakersLock.Lock()
+		key := channelStatsKey{channelId: channelId, model: modelName}
+		if breaker, ok := circuitBreakers[key]; ok {
+			previousState = breaker.state
+			// a slow request which started before the breaker opened does not close it
+			if breaker.state != CircuitOpen {
+				delete(circuitBreakers, key)
+			}
+		}
+		circuitBreakersLock.Unlock()
+	}
+	if previousState == CircuitHalfOpen {
+		logger.SysLog(fmt.Sprintf("circuit breaker of channel #%d for model %s is closed", channelId, modelName))
+	}
+}
+
+func recordCircuitFailure(channelId int, modelName string) {
+	now := time.Now().UnixMilli()
+	opened := false
+	if common.RedisEnabled {
+		result, err := circuitFailureScript.Run(context.Background(), common.RDB, []string{circuitBreakerKey(channelId, modelName)},
+			now, config.CircuitBreakerFailureThreshold, circuitBreakerExpiration()).Int()
+		if err != nil {
+			logger.SysError("failed to update circuit breaker: " + err.Error())
+			return
+		}
+		opened = result == 1
+	} else {
+		circuitBreakersLock.Lock()
+		key := channelStatsKey{channelId: channelId, model: modelName}
+		breaker, ok := circuitBreakers[key]
+		if !ok {
+			breaker = &circuitBreaker{}
+			circuitBreakers[key] = breaker
+		}
+		opened = breaker.onFailure(now, config.CircuitBreakerFailureThreshold)
+		circuitBreakersLock.Unlock()
+	}
+	if opened {
+		logger.SysLog(fmt.Sprintf("circuit breaker of channel #%d for model %s is open for %d seconds", channelId, modelName, config.CircuitBreakerCooldown))
+	}
+}
+
+// pickChannel picks one of the candidates by weight and takes a slot of it, skipping those whose
+// circuit breaker is open for the model, which are at their concurrency or rate limit or whose
+// context is too short for the prompt. It returns -1 if none is left, together with an error if some
+// were skipped for being full.
+func pickChannel(channels []*Channel, weights []uint, modelName string, promptTokens int) (int, *ChannelBusyError) {
+	indexes := make([]int, len(channels))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	weights = append([]uint(nil), weights...)
+	var busy *ChannelBusyError
+	for len(indexes) > 0 {
+		i := random.WeightedIndex(weights)
+		channel := channels[indexes[i]]
+		switch {
+		case !channel.fitsContext(modelName, promptTokens):
+		case !acquireChannelSlot(channel):
+			busy = busy.merge(&ChannelBusyError{QueueTimeout: time.Duration(channel.GetQueueTimeout()) * time.Second})
+		// the breaker is asked first, so that a rejected channel is not charged a request
+		case !acquireCircuit(channel.Id, modelName):
+			ReleaseChannelSlot(channel)
+		case !acquireChannelBudget(channel, modelName):
+			ReleaseChannelSlot(channel)
+			ReleaseCircuitProbe(channel.Id, modelName)
+			busy = busy.merge(&ChannelBusyError{})
+		default:
+			return indexes[i], nil
+		}
+		indexes = append(indexes[:i], indexes[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return -1, busy
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	Convey("circuit breaker", t, func() {
+		common.RedisEnabled = false
+		config.CircuitBreakerEnabled = true
+		threshold, cooldownSeconds, halfOpenRequests := config.CircuitBreakerFailureThreshold, config.CircuitBreakerCooldown, config.CircuitBreakerHalfOpenRequests
+		config.CircuitBreakerFailureThreshold, config.CircuitBreakerCooldown, config.CircuitBreakerHalfOpenRequests = 3, 30, 1
+		reset := func() {
+			circuitBreakersLock.Lock()
+			circuitBreakers = make(map[channelStatsKey]*circuitBreaker)
+			circuitBreakersLock.Unlock()
+		}
+		reset()
+		defer func() {
+			reset()
+			config.CircuitBreakerEnabled = false
+			config.CircuitBreakerFailureThreshold, config.CircuitBreakerCooldown, config.CircuitBreakerHalfOpenRequests = threshold, cooldownSeconds, halfOpenRequests
+		}()
+		key := channelStatsKey{channelId: 1002, model: "gpt-4o"}
+		cooldown := int64(config.CircuitBreakerCooldown) * 1000
+		state := func() int {
+			circuitBreakersLock.Lock()
+			defer circuitBreakersLock.Unlock()
+			if breaker, ok := circuitBreakers[key]; ok {
+				return breaker.state
+			}
+			return CircuitClosed
+		}
+		// open puts the breaker in open state long enough ago for the cooldown to have passed
+		open := func() {
+			circuitBreakersLock.Lock()
+			circuitBreakers[key] = &circuitBreaker{state: CircuitOpen, since: time.Now().UnixMilli() - cooldown}
+			circuitBreakersLock.Unlock()
+		}
+
+		Convey("opens after consecutive failures", func() {
+			RecordCircuitResult(key.channelId, key.model, false)
+			RecordCircuitResult(key.channelId, key.model, false)
+			So(state(), ShouldEqual, CircuitClosed)
+			So(acquireCircuit(key.channelId, key.model), ShouldBeTrue)
+			RecordCircuitResult(key.channelId, key.model, false)
+			So(state(), ShouldEqual, CircuitOpen)
+			So(acquireCircuit(key.channelId, key.model), ShouldBeFalse)
+		})
+
+		Convey("forgets the failures after a success", func() {
+			RecordCircuitResult(key.channelId, key.model, false)
+			RecordCircuitResult(key.channelId, key.model, false)
+			RecordCircuitResult(key.channelId, key.model, true)
+			RecordCircuitResult(key.channelId, key.model, false)
+			RecordCircuitResult(key.channelId, key.model, false)
+			So(state(), ShouldEqual, CircuitClosed)
+		})
+
+		Convey("lets a probe through after the cooldown and closes when it succeeds", func() {
+			open()
+			So(acquireCircuit(key.channelId, key.model), ShouldBeTrue)
+			So(state(), ShouldEqual, CircuitHalfOpen)
+			So(acquireCircuit(key.channelId, key.model), ShouldBeFalse)
+			RecordCircuitResult(key.channelId, key.model, true)
+			So(state(), ShouldEqual, CircuitClosed)
+			So(acquireCircuit(key.channelId, key.model), ShouldBeTrue)
+		})
+
+		Convey("opens again when the probe fails", func() {
+			open()
+			So(acquireCircuit(key.channelId, key.model), ShouldBeTrue)
+			RecordCircuitResult(key.channelId, key.model, false)
+			So(state(), ShouldEqual, CircuitOpen)
+			So(acquireCircuit(key.channelId, key.model), ShouldBeFalse)
+		})
+
+		Convey("gives up a probe which never reported back after another cooldown", func() {
+			breaker := &circuitBreaker{state: CircuitOpen}
+			So(breaker.acquire(cooldown, cooldown, 1), ShouldBeTrue)
+			So(breaker.acquire(cooldown+1, cooldown, 1), ShouldBeFalse)
+			So(breaker.acquire(2*cooldown, cooldown, 1), ShouldBeTrue)
+			So(breaker.state, ShouldEqual, CircuitHalfOpen)
+		})
+	})
+}
@@ -8,8 +8,6 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
-	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
@@ -224,9 +222,9 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
+func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool, promptTokens int) (*Channel, error) {
 	if !config.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, ignoreFirstPriority)
+		return GetRandomSatisfiedChannel(group, model, ignoreFirstPriority, promptTokens)
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
@@ -245,11 +243,110 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 			}
 		}
 	}
-	idx := rand.Intn(endIdx)
+	tiers := [][]*Channel{channels[:endIdx], channels[endIdx:]}
 	if ignoreFirstPriority {
 		if endIdx < len(channels) { // which means there are more than one priority
-			idx = random.RandRange(endIdx, len(channels))
+			tiers[0], tiers[1] = tiers[1], tiers[0]
 		}
 	}
-	return channels[idx], nil
+	// the other channels are only tried when the chosen ones are all full or their circuit breakers are open
+	var busy *ChannelBusyError
+	for _, candidates := range tiers {
+		channelIds := make([]int, len(candidates))
+		weights := make([]uint, len(candidates))
+		for i, channel := range candidates {
+			channelIds[i] = channel.Id
+			weights[i] = channel.GetWeight()
+		}
+		weights = balanceWeights(channelIds, weights, model)
+		idx, tierBusy := pickChannel(candidates, weights, model, promptTokens)
+		if idx >= 0 {
+			return candidates[idx], nil
+		}
+		busy = busy.merge(tierBusy)
+	}
+	if busy != nil {
+		return nil, busy
+	}
+	return nil, errors.New("channel not found")
+}
+
+// CacheGetHedgeChannel picks a channel of the model other than the one a hedged request was sent to,
+// from the highest priority which has one.
+func CacheGetHedgeChannel(group string, model string, excludedChannelId int, promptTokens int) (*Channel, error) {
+	var channels []*Channel
+	if config.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels = append(channels, group2model2channels[group][model]...)
+		channelSyncLock.RUnlock()
+	} else {
+		var err error
+		channels, err = getSatisfiedChannels(group, model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Id != excludedChannelId {
+			candidates = append(candidates, channel)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].GetPriority() > candidates[j].GetPriority()
+	})
+	var busy *ChannelBusyError
+	for start, end := 0, 0; start < len(candidates); start = end {
+		for end = start + 1; end < len(candidates) && candidates[end].GetPriority() == candidates[start].GetPriority(); end++ {
+		}
+		tier := candidates[start:end]
+		channelIds := make([]int, len(tier))
+		weights := make([]uint, len(tier))
+		for i, channel := range tier {
+			channelIds[i] = channel.Id
+			weights[i] = channel.GetWeight()
+		}
+		weights = balanceWeights(channelIds, weights, model)
+		idx, tierBusy := pickChannel(tier, weights, model, promptTokens)
+		if idx >= 0 {
+			return tier[idx], nil
+		}
+		busy = busy.merge(tierBusy)
+	}
+	if busy != nil {
+		return nil, busy
+	}
+	return nil, errors.New("channel not found")
+}
+
+// CacheGetMaxContext returns the longest prompt in tokens some channel of the model accepts, 0 if one
+// of them is unlimited. limited tells whether any of them has a limit, the prompt is only worth
+// counting before picking a channel then.
+func CacheGetMaxContext(group string, model string) (maxContext int, limited bool) {
+	var channels []*Channel
+	if config.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels = append(channels, group2model2channels[group][model]...)
+		channelSyncLock.RUnlock()
+	} else {
+		var err error
+		channels, err = getSatisfiedChannels(group, model)
+		if err != nil {
+			return 0, false
+		}
+	}
+	unlimited := false
+	for _, channel := range channels {
+		channelMaxContext := channel.GetMaxContext(model)
+		if channelMaxContext <= 0 {
+			unlimited = true
+			continue
+		}
+		limited = true
+		maxContext = max(maxContext, channelMaxContext)
+	}
+	if unlimited {
+		maxContext = 0
+	}
+	return maxContext, limited
 }
@@ -18,26 +18,41 @@ const (
 )
 
 type Channel struct {
-	Id                 int     `json:"id"`
-	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"type:text"`
-	Status             int     `json:"status" gorm:"default:1"`
-	Name               string  `json:"name" gorm:"index"`
-	Weight             *uint   `json:"weight" gorm:"default:0"`
-	CreatedTime        int64   `json:"created_time" gorm:"bigint"`
-	TestTime           int64   `json:"test_time" gorm:"bigint"`
-	ResponseTime       int     `json:"response_time"` // in milliseconds
-	BaseURL            *string `json:"base_url" gorm:"column:base_url;default:''"`
-	Other              *string `json:"other"`   // DEPRECATED: please save config to field Config
-	Balance            float64 `json:"balance"` // in USD
-	BalanceUpdatedTime int64   `json:"balance_updated_time" gorm:"bigint"`
-	Models             string  `json:"models"`
-	Group              string  `json:"group" gorm:"type:varchar(32);default:'default'"`
-	UsedQuota          int64   `json:"used_quota" gorm:"bigint;default:0"`
-	ModelMapping       *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
-	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
-	Config             string  `json:"config"`
-	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	Id                 int           `json:"id"`
+	Type               int           `json:"type" gorm:"default:0"`
+	Key                string        `json:"key" gorm:"type:text"`
+	Status             int           `json:"status" gorm:"default:1"`
+	Name               string        `json:"name" gorm:"index"`
+	Weight             *uint         `json:"weight" gorm:"default:0"`
+	CreatedTime        int64         `json:"created_time" gorm:"bigint"`
+	TestTime           int64         `json:"test_time" gorm:"bigint"`
+	ResponseTime       int           `json:"response_time"` // in milliseconds
+	BaseURL            *string       `json:"base_url" gorm:"column:base_url;default:''"`
+	Other              *string       `json:"other"`   // DEPRECATED: please save config to field Config
+	Balance            float64       `json:"balance"` // in USD
+	BalanceUpdatedTime int64         `json:"balance_updated_time" gorm:"bigint"`
+	Models             string        `json:"models"`
+	Group              string        `json:"group" gorm:"type:varchar(32);default:'default'"`
+	UsedQuota          int64         `json:"used_quota" gorm:"bigint;default:0"`
+	ModelMapping       *string       `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
+	Priority           *int64        `json:"priority" gorm:"bigint;default:0"`
+	Config             string        `json:"config"`
+	SystemPrompt       *string       `json:"system_prompt" gorm:"type:text"`
+	MaxConcurrency     *int          `json:"max_concurrency" gorm:"default:0"`
+	QueueTimeout       *int          `json:"queue_timeout" gorm:"default:0"` // in seconds
+	RPMLimit           *int          `json:"rpm_limit" gorm:"default:0"`
+	TPMLimit           *int          `json:"tpm_limit" gorm:"default:0"`
+	ModelRateLimits    *string       `json:"model_rate_limits" gorm:"type:text"`
+	KeyPolicy          *string       `json:"key_policy" gorm:"default:''"`
+	MaxContext         *int          `json:"max_context" gorm:"default:0"` // in tokens
+	ModelMaxContexts   *string       `json:"model_max_contexts" gorm:"type:text"`
+	Keys               []*ChannelKey `json:"keys,omitempty" gorm:"-"`
+}
+
+// RateLimit is the number of requests and tokens a channel may serve per minute, 0 means unlimited
+type RateLimit struct {
+	RPM int `json:"rpm"`
+	TPM int `json:"tpm"`
 }
 
 type ChannelConfig struct {
@@ -104,6 +119,75 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+func (channel *Channel) GetWeight() uint {
+	if channel.Weight == nil {
+		return 0
+	}
+	return *channel.Weight
+}
+
+func (channel *Channel) GetMaxConcurrency() int {
+	if channel.MaxConcurrency == nil {
+		return 0
+	}
+	return *channel.MaxConcurrency
+}
+
+func (channel *Channel) GetQueueTimeout() int {
+	if channel.QueueTimeout == nil {
+		return 0
+	}
+	return *channel.QueueTimeout
+}
+
+func (channel *Channel) GetRateLimit() RateLimit {
+	var rateLimit RateLimit
+	if channel.RPMLimit != nil {
+		rateLimit.RPM = *channel.RPMLimit
+	}
+	if channel.TPMLimit != nil {
+		rateLimit.TPM = *channel.TPMLimit
+	}
+	return rateLimit
+}
+
+// GetModelRateLimit returns the limits of the model on the channel on top of those of the channel.
+func (channel *Channel) GetModelRateLimit(modelName string) RateLimit {
+	if channel.ModelRateLimits == nil || *channel.ModelRateLimits == "" || *channel.ModelRateLimits == "{}" {
+		return RateLimit{}
+	}
+	modelRateLimits := make(map[string]RateLimit)
+	err := json.Unmarshal([]byte(*channel.ModelRateLimits), &modelRateLimits)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to unmarshal model rate limits for channel %d, error: %s", channel.Id, err.Error()))
+		return RateLimit{}
+	}
+	return modelRateLimits[modelName]
+}
+
+// GetMaxContext returns the longest prompt in tokens the channel accepts for the model, 0 means unlimited.
+func (channel *Channel) GetMaxContext(modelName string) int {
+	if channel.ModelMaxContexts != nil && *channel.ModelMaxContexts != "" && *channel.ModelMaxContexts != "{}" {
+		modelMaxContexts := make(map[string]int)
+		err := json.Unmarshal([]byte(*channel.ModelMaxContexts), &modelMaxContexts)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to unmarshal model max contexts for channel %d, error: %s", channel.Id, err.Error()))
+		} else if maxContext, ok := modelMaxContexts[modelName]; ok {
+			return maxContext
+		}
+	}
+	if channel.MaxContext == nil {
+		return 0
+	}
+	return *channel.MaxContext
+}
+
+// fitsContext tells whether the channel accepts a prompt of the tokens for the model.
+func (channel *Channel) fitsContext(modelName string, promptTokens int) bool {
+	maxContext := channel.GetMaxContext(modelName)
+	return maxContext <= 0 || promptTokens <= maxContext
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -136,13 +220,26 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
+	// an empty key is left as it is
+	keyChanged := false
+	if channel.Key != "" {
+		previous, err := GetChannelById(channel.Id, true)
+		keyChanged = err != nil || previous.Key != channel.Key
+	}
 	err = DB.Model(channel).Updates(channel).Error
 	if err != nil {
 		return err
 	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	if !keyChanged {
+		return nil
+	}
+	// the keys disabled on their own stay disabled until the keys of the channel are edited
+	return resetChannelKeys(channel)
 }
 
 func (channel *Channel) UpdateResponseTime(responseTime int64) {
@@ -172,7 +269,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKey{}).Error
 }
 
 func (channel *Channel) LoadConfig() (ChannelConfig, error) {
@@ -196,6 +296,12 @@ func UpdateChannelStatusById(id int, status int) {
 	if err != nil {
 		logger.SysError("failed to update channel status: " + err.Error())
 	}
+	if status == ChannelStatusEnabled {
+		err = enableChannelKeys(id)
+		if err != nil {
+			logger.SysError("failed to enable channel keys: " + err.Error())
+		}
+	}
 }
 
 func UpdateChannelUsedQuota(id int, quota int64) {
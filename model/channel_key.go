@@ -0,0 +1,359 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// A channel may hold several keys, one per line, which are used in turn according to the key policy
+// of the channel. The health and usage of each key is kept in ChannelKey, so that a bad key gets
+// disabled on its own while the channel goes on with the others.
+
+const (
+	KeyPolicyRoundRobin = "round_robin"
+	KeyPolicyRandom     = "random"
+	KeyPolicyLeastUsed  = "least_used"
+)
+
+type ChannelKey struct {
+	ChannelId      int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	KeyHash        string `json:"-" gorm:"primaryKey;type:varchar(16)"`
+	Index          int    `json:"index" gorm:"-"`
+	Key            string `json:"key" gorm:"-"` // masked
+	Status         int    `json:"status" gorm:"default:1"`
+	RequestCount   int64  `json:"request_count" gorm:"bigint;default:0"`
+	FailureCount   int64  `json:"failure_count" gorm:"bigint;default:0"`
+	UsedTokens     int64  `json:"used_tokens" gorm:"bigint;default:0"`
+	DisabledReason string `json:"disabled_reason" gorm:"type:text"`
+	UpdatedTime    int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (channel *Channel) GetKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (channel *Channel) GetKeyPolicy() string {
+	if channel.KeyPolicy == nil || *channel.KeyPolicy == "" {
+		return KeyPolicyRoundRobin
+	}
+	return *channel.KeyPolicy
+}
+
+// HashChannelKey identifies a key of a channel without storing it again.
+func HashChannelKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// GetKeyByHash returns the key of the channel with the hash, or "" if the channel no longer has it.
+func (channel *Channel) GetKeyByHash(hash string) string {
+	for _, key := range channel.GetKeys() {
+		if HashChannelKey(key) == hash {
+			return key
+		}
+	}
+	return ""
+}
+
+func MaskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", len(key)-8) + key[len(key)-4:]
+}
+
+func (key *ChannelKey) enabled() bool {
+	return key == nil || key.Status == ChannelStatusEnabled
+}
+
+type channelKeySet struct {
+	keys     map[string]*ChannelKey
+	loadedAt time.Time
+	next     uint64
+}
+
+// channelKeySets caches the key states of the channels with several keys, the states changed by
+// other nodes are picked up when the cache is reloaded
+var channelKeySets = make(map[int]*channelKeySet)
+var channelKeySetsLock sync.Mutex
+
+func (set *channelKeySet) fresh() bool {
+	return time.Since(set.loadedAt) < time.Duration(config.SyncFrequency)*time.Second
+}
+
+// lockChannelKeySet returns the key states of the channel with channelKeySetsLock held, the caller
+// unlocks it. Stale states are reloaded without holding the lock, so that the picks of the other
+// channels do not wait for the database.
+func lockChannelKeySet(channelId int) *channelKeySet {
+	channelKeySetsLock.Lock()
+	if set, ok := channelKeySets[channelId]; ok && set.fresh() {
+		return set
+	}
+	channelKeySetsLock.Unlock()
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Find(&keys).Error
+	if err != nil {
+		logger.SysError("failed to load channel keys: " + err.Error())
+	}
+	loaded := make(map[string]*ChannelKey, len(keys))
+	for _, key := range keys {
+		loaded[key.KeyHash] = key
+	}
+	channelKeySetsLock.Lock()
+	set, ok := channelKeySets[channelId]
+	if !ok {
+		set = &channelKeySet{}
+		channelKeySets[channelId] = set
+	} else if set.fresh() {
+		// another request reloaded it meanwhile
+		return set
+	}
+	set.keys, set.loadedAt = loaded, time.Now()
+	return set
+}
+
+// PickChannelKey chooses the key a request is sent with among the enabled keys of the channel, the
+// requests with an affinity key stick to the key it hashes to.
+func PickChannelKey(channel *Channel, affinity string) string {
+	keys := channel.GetKeys()
+	if len(keys) <= 1 {
+		return strings.TrimSpace(channel.Key)
+	}
+	set := lockChannelKeySet(channel.Id)
+	defer channelKeySetsLock.Unlock()
+	enabledKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if set.keys[HashChannelKey(key)].enabled() {
+			enabledKeys = append(enabledKeys, key)
+		}
+	}
+	if len(enabledKeys) == 0 {
+		// the channel is being disabled
+		enabledKeys = keys
+	}
+	if affinity != "" {
+		hashes := make([]string, len(enabledKeys))
+		for i, key := range enabledKeys {
+			hashes[i] = HashChannelKey(key)
+		}
+		return enabledKeys[rendezvousIndex(affinity, hashes, make([]uint, len(hashes)))]
+	}
+	switch channel.GetKeyPolicy() {
+	case KeyPolicyRandom:
+		return enabledKeys[rand.Intn(len(enabledKeys))]
+	case KeyPolicyLeastUsed:
+		leastUsed, leastRequests := enabledKeys[0], int64(-1)
+		for _, key := range enabledKeys {
+			var requests int64
+			if state := set.keys[HashChannelKey(key)]; state != nil {
+				requests = state.RequestCount
+			}
+			if leastRequests < 0 || requests < leastRequests {
+				leastUsed, leastRequests = key, requests
+			}
+		}
+		return leastUsed
+	default:
+		key := enabledKeys[set.next%uint64(len(enabledKeys))]
+		set.next++
+		return key
+	}
+}
+
+// RecordChannelKeyUsage counts a request sent with one of the keys of a channel with several keys.
+func RecordChannelKeyUsage(channelId int, key string, success bool, tokens int) {
+	channelKeySetsLock.Lock()
+	set, ok := channelKeySets[channelId]
+	if !ok {
+		// only the channels with several keys are tracked
+		channelKeySetsLock.Unlock()
+		return
+	}
+	hash := HashChannelKey(key)
+	state, ok := set.keys[hash]
+	if !ok {
+		state = &ChannelKey{ChannelId: channelId, KeyHash: hash, Status: ChannelStatusEnabled}
+		set.keys[hash] = state
+	}
+	var failures int64
+	if !success {
+		failures = 1
+	}
+	state.RequestCount++
+	state.FailureCount += failures
+	state.UsedTokens += int64(tokens)
+	state.UpdatedTime = helper.GetTimestamp()
+	channelKeySetsLock.Unlock()
+
+	usage := ChannelKey{ChannelId: channelId, KeyHash: hash, RequestCount: 1, FailureCount: failures, UsedTokens: int64(tokens)}
+	if config.BatchUpdateEnabled {
+		addChannelKeyUsage(usage)
+		return
+	}
+	updateChannelKeyUsage(usage)
+}
+
+type channelKeyId struct {
+	channelId int
+	keyHash   string
+}
+
+var channelKeyUsageStore = make(map[channelKeyId]*ChannelKey)
+var channelKeyUsageLock sync.Mutex
+
+func addChannelKeyUsage(usage ChannelKey) {
+	channelKeyUsageLock.Lock()
+	defer channelKeyUsageLock.Unlock()
+	id := channelKeyId{channelId: usage.ChannelId, keyHash: usage.KeyHash}
+	if stored, ok := channelKeyUsageStore[id]; ok {
+		stored.RequestCount += usage.RequestCount
+		stored.FailureCount += usage.FailureCount
+		stored.UsedTokens += usage.UsedTokens
+	} else {
+		channelKeyUsageStore[id] = &usage
+	}
+}
+
+// batchUpdateChannelKeyUsage writes the key usage gathered since the last batch update.
+func batchUpdateChannelKeyUsage() {
+	channelKeyUsageLock.Lock()
+	store := channelKeyUsageStore
+	channelKeyUsageStore = make(map[channelKeyId]*ChannelKey)
+	channelKeyUsageLock.Unlock()
+	for _, usage := range store {
+		updateChannelKeyUsage(*usage)
+	}
+}
+
+func updateChannelKeyUsage(usage ChannelKey) {
+	now := helper.GetTimestamp()
+	result := DB.Model(&ChannelKey{}).Where("channel_id = ? and key_hash = ?", usage.ChannelId, usage.KeyHash).Updates(map[string]any{
+		"request_count": gorm.Expr("request_count + ?", usage.RequestCount),
+		"failure_count": gorm.Expr("failure_count + ?", usage.FailureCount),
+		"used_tokens":   gorm.Expr("used_tokens + ?", usage.UsedTokens),
+		"updated_time":  now,
+	})
+	if result.Error == nil && result.RowsAffected == 0 {
+		usage.Status = ChannelStatusEnabled
+		usage.UpdatedTime = now
+		result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage)
+	}
+	if result.Error != nil {
+		logger.SysError("failed to update channel key usage: " + result.Error.Error())
+	}
+}
+
+// DisableChannelKey disables one key of a channel with several keys. It returns false if the channel
+// has a single key, which is disabled along with the channel, and otherwise the number of keys left.
+func DisableChannelKey(channelId int, key string, reason string) (bool, int, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return false, 0, err
+	}
+	keys := channel.GetKeys()
+	if len(keys) <= 1 || key == "" {
+		return false, 0, nil
+	}
+	state := ChannelKey{
+		ChannelId:      channelId,
+		KeyHash:        HashChannelKey(key),
+		Status:         ChannelStatusAutoDisabled,
+		DisabledReason: reason,
+		UpdatedTime:    helper.GetTimestamp(),
+	}
+	err = DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"status", "disabled_reason", "updated_time"}),
+	}).Create(&state).Error
+	if err != nil {
+		return true, 0, err
+	}
+	set := lockChannelKeySet(channelId)
+	defer channelKeySetsLock.Unlock()
+	if cached, ok := set.keys[state.KeyHash]; ok {
+		cached.Status, cached.DisabledReason, cached.UpdatedTime = state.Status, state.DisabledReason, state.UpdatedTime
+	} else {
+		set.keys[state.KeyHash] = &state
+	}
+	remaining := 0
+	for _, key := range keys {
+		if set.keys[HashChannelKey(key)].enabled() {
+			remaining++
+		}
+	}
+	return true, remaining, nil
+}
+
+// enableChannelKeys enables the keys of the channel again.
+func enableChannelKeys(channelId int) error {
+	err := DB.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Updates(map[string]any{
+		"status":          ChannelStatusEnabled,
+		"disabled_reason": "",
+	}).Error
+	channelKeySetsLock.Lock()
+	delete(channelKeySets, channelId)
+	channelKeySetsLock.Unlock()
+	return err
+}
+
+// resetChannelKeys enables the keys of the channel again and forgets the keys it no longer has.
+func resetChannelKeys(channel *Channel) error {
+	hashes := []string{""}
+	for _, key := range channel.GetKeys() {
+		hashes = append(hashes, HashChannelKey(key))
+	}
+	err := DB.Where("channel_id = ? and key_hash not in ?", channel.Id, hashes).Delete(&ChannelKey{}).Error
+	if err != nil {
+		return err
+	}
+	return enableChannelKeys(channel.Id)
+}
+
+// GetChannelKeys returns the health and usage of the keys of a channel with several keys.
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return nil, err
+	}
+	keys := channel.GetKeys()
+	if len(keys) <= 1 {
+		return nil, nil
+	}
+	var states []*ChannelKey
+	err = DB.Where("channel_id = ?", channel.Id).Find(&states).Error
+	if err != nil {
+		return nil, err
+	}
+	statesByHash := make(map[string]*ChannelKey, len(states))
+	for _, state := range states {
+		statesByHash[state.KeyHash] = state
+	}
+	channelKeys := make([]*ChannelKey, len(keys))
+	for i, key := range keys {
+		state, ok := statesByHash[HashChannelKey(key)]
+		if !ok {
+			state = &ChannelKey{ChannelId: channel.Id, KeyHash: HashChannelKey(key), Status: ChannelStatusEnabled}
+		}
+		state.Index = i
+		state.Key = MaskChannelKey(key)
+		channelKeys[i] = state
+	}
+	return channelKeys, nil
+}
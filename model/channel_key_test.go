@@ -0,0 +1,99 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestPickChannelKey(t *testing.T) {
+	Convey("PickChannelKey", t, func() {
+		var err error
+		DB, err = gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		So(err, ShouldBeNil)
+		So(DB.AutoMigrate(&Channel{}, &ChannelKey{}), ShouldBeNil)
+		common.UsingSQLite = true
+		common.RedisEnabled = false
+		config.BatchUpdateEnabled = false
+		channelKeySetsLock.Lock()
+		channelKeySets = make(map[int]*channelKeySet)
+		channelKeySetsLock.Unlock()
+		policy := KeyPolicyRoundRobin
+		channel := &Channel{Id: 1, Status: ChannelStatusEnabled, Key: "sk-1\nsk-2\nsk-3", KeyPolicy: &policy}
+		So(DB.Create(channel).Error, ShouldBeNil)
+		pick := func(affinity string, times int) []string {
+			keys := make([]string, times)
+			for i := range keys {
+				keys[i] = PickChannelKey(channel, affinity)
+			}
+			return keys
+		}
+
+		Convey("uses the only key of a channel", func() {
+			single := &Channel{Id: 2, Key: " sk-only "}
+			So(PickChannelKey(single, ""), ShouldEqual, "sk-only")
+		})
+
+		Convey("uses the keys in turn by round robin", func() {
+			So(pick("", 4), ShouldResemble, []string{"sk-1", "sk-2", "sk-3", "sk-1"})
+		})
+
+		Convey("uses the key with the fewest requests by least used", func() {
+			policy = KeyPolicyLeastUsed
+			So(DB.Create(&[]ChannelKey{
+				{ChannelId: 1, KeyHash: HashChannelKey("sk-1"), Status: ChannelStatusEnabled, RequestCount: 5},
+				{ChannelId: 1, KeyHash: HashChannelKey("sk-2"), Status: ChannelStatusEnabled, RequestCount: 1},
+				{ChannelId: 1, KeyHash: HashChannelKey("sk-3"), Status: ChannelStatusEnabled, RequestCount: 3},
+			}).Error, ShouldBeNil)
+			So(PickChannelKey(channel, ""), ShouldEqual, "sk-2")
+			for i := 0; i < 3; i++ {
+				RecordChannelKeyUsage(channel.Id, "sk-2", true, 10)
+			}
+			So(PickChannelKey(channel, ""), ShouldEqual, "sk-3")
+			var state ChannelKey
+			So(DB.Where("channel_id = ? and key_hash = ?", 1, HashChannelKey("sk-2")).First(&state).Error, ShouldBeNil)
+			So(state.RequestCount, ShouldEqual, 4)
+			So(state.UsedTokens, ShouldEqual, 30)
+		})
+
+		Convey("sticks to one key for an affinity", func() {
+			keys := pick("session:a", 5)
+			for _, key := range keys {
+				So(key, ShouldEqual, keys[0])
+			}
+		})
+
+		Convey("skips the disabled keys", func() {
+			multiKey, remaining, err := DisableChannelKey(channel.Id, "sk-2", "invalid key")
+			So(err, ShouldBeNil)
+			So(multiKey, ShouldBeTrue)
+			So(remaining, ShouldEqual, 2)
+			So(pick("", 4), ShouldResemble, []string{"sk-1", "sk-3", "sk-1", "sk-3"})
+			_, _, _ = DisableChannelKey(channel.Id, "sk-1", "invalid key")
+			So(pick("session:a", 3), ShouldResemble, []string{"sk-3", "sk-3", "sk-3"})
+		})
+
+		Convey("uses every key when all of them are disabled", func() {
+			for _, key := range channel.GetKeys() {
+				_, _, _ = DisableChannelKey(channel.Id, key, "invalid key")
+			}
+			So(pick("", 3), ShouldResemble, []string{"sk-1", "sk-2", "sk-3"})
+		})
+
+		Convey("reloads the states changed by other nodes once stale", func() {
+			So(PickChannelKey(channel, ""), ShouldEqual, "sk-1")
+			So(DB.Create(&ChannelKey{ChannelId: 1, KeyHash: HashChannelKey("sk-2"), Status: ChannelStatusAutoDisabled}).Error, ShouldBeNil)
+			So(PickChannelKey(channel, ""), ShouldEqual, "sk-2")
+			channelKeySetsLock.Lock()
+			channelKeySets[channel.Id].loadedAt = time.Now().Add(-time.Duration(config.SyncFrequency+1) * time.Second)
+			channelKeySetsLock.Unlock()
+			So(pick("", 2), ShouldResemble, []string{"sk-1", "sk-3"})
+		})
+	})
+}
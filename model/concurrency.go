@@ -0,0 +1,197 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// A channel with a concurrency limit only gets picked while it has a free slot, the slot is taken
+// when the channel is picked and given back once the request is done. The slots in use are counted
+// in Redis when it is enabled so that the limit holds across nodes. When every candidate is full the
+// request waits in a queue for a slot, in the order the requests arrived.
+
+const (
+	// channelSlotExpiration forgets the slots of a node which died while serving requests
+	channelSlotExpiration = 10 * time.Minute
+	// queuePollInterval is how often the head of a queue looks for slots freed on other nodes
+	queuePollInterval = 100 * time.Millisecond
+)
+
+// ChannelBusyError is returned when the candidate channels are all at their concurrency limit.
+type ChannelBusyError struct {
+	// QueueTimeout is the longest queue timeout of the full channels
+	QueueTimeout time.Duration
+}
+
+func (e *ChannelBusyError) Error() string {
+	return "all channels are busy"
+}
+
+func (e *ChannelBusyError) merge(other *ChannelBusyError) *ChannelBusyError {
+	if e == nil {
+		return other
+	}
+	if other != nil {
+		e.QueueTimeout = max(e.QueueTimeout, other.QueueTimeout)
+	}
+	return e
+}
+
+var channelSlots = make(map[int]int)
+var channelSlotsLock sync.Mutex
+
+var acquireChannelSlotScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var releaseChannelSlotScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 1
+`)
+
+func channelSlotKey(channelId int) string {
+	return fmt.Sprintf("channel_concurrency:%d", channelId)
+}
+
+// acquireChannelSlot takes a slot of the channel if it has a concurrency limit.
+func acquireChannelSlot(channel *Channel) bool {
+	maxConcurrency := channel.GetMaxConcurrency()
+	if maxConcurrency <= 0 {
+		return true
+	}
+	if common.RedisEnabled {
+		acquired, err := acquireChannelSlotScript.Run(context.Background(), common.RDB, []string{channelSlotKey(channel.Id)},
+			maxConcurrency, channelSlotExpiration.Milliseconds()).Int()
+		if err != nil {
+			logger.SysError("failed to acquire channel slot: " + err.Error())
+			return true
+		}
+		return acquired == 1
+	}
+	channelSlotsLock.Lock()
+	defer channelSlotsLock.Unlock()
+	if channelSlots[channel.Id] >= maxConcurrency {
+		return false
+	}
+	channelSlots[channel.Id]++
+	return true
+}
+
+// ReleaseChannelSlot gives back the slot taken when the channel was picked.
+func ReleaseChannelSlot(channel *Channel) {
+	if channel.GetMaxConcurrency() <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		err := releaseChannelSlotScript.Run(context.Background(), common.RDB, []string{channelSlotKey(channel.Id)}).Err()
+		if err != nil {
+			logger.SysError("failed to release channel slot: " + err.Error())
+		}
+	} else {
+		channelSlotsLock.Lock()
+		if channelSlots[channel.Id] > 0 {
+			channelSlots[channel.Id]--
+		}
+		channelSlotsLock.Unlock()
+	}
+	wakeWaiters()
+}
+
+// waiters is closed and replaced whenever the waiting requests should look for a slot again
+var waiters = make(chan struct{})
+var waitersLock sync.Mutex
+
+func wakeWaiters() {
+	waitersLock.Lock()
+	close(waiters)
+	waiters = make(chan struct{})
+	waitersLock.Unlock()
+}
+
+func getWaiters() <-chan struct{} {
+	waitersLock.Lock()
+	defer waitersLock.Unlock()
+	return waiters
+}
+
+var waitQueues = make(map[string][]uint64)
+var waitQueuesLock sync.Mutex
+var nextTicket uint64
+
+func joinWaitQueue(key string) uint64 {
+	waitQueuesLock.Lock()
+	defer waitQueuesLock.Unlock()
+	nextTicket++
+	waitQueues[key] = append(waitQueues[key], nextTicket)
+	return nextTicket
+}
+
+func leaveWaitQueue(key string, ticket uint64) {
+	waitQueuesLock.Lock()
+	queue := waitQueues[key]
+	for i := range queue {
+		if queue[i] == ticket {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(waitQueues, key)
+	} else {
+		waitQueues[key] = queue
+	}
+	waitQueuesLock.Unlock()
+	// the next request in the queue may go now
+	wakeWaiters()
+}
+
+func isWaitQueueHead(key string, ticket uint64) bool {
+	waitQueuesLock.Lock()
+	defer waitQueuesLock.Unlock()
+	return waitQueues[key][0] == ticket
+}
+
+// WaitForSatisfiedChannel queues the request behind the earlier ones waiting for the model in the
+// group until one of the channels has a free slot, and gives up after the timeout.
+func WaitForSatisfiedChannel(ctx context.Context, group string, model string, promptTokens int, timeout time.Duration) (*Channel, error) {
+	key := group + ":" + model
+	ticket := joinWaitQueue(key)
+	defer leaveWaitQueue(key, ticket)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	for {
+		wake := getWaiters()
+		if isWaitQueueHead(key, ticket) {
+			channel, err := CacheGetRandomSatisfiedChannel(group, model, false, promptTokens)
+			if _, busy := err.(*ChannelBusyError); !busy {
+				return channel, err
+			}
+		}
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-deadline.C:
+			return nil, &ChannelBusyError{QueueTimeout: timeout}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
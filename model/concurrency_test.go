@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestWaitForSatisfiedChannel(t *testing.T) {
+	Convey("WaitForSatisfiedChannel", t, func() {
+		var err error
+		DB, err = gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		So(err, ShouldBeNil)
+		So(DB.AutoMigrate(&Channel{}, &Ability{}), ShouldBeNil)
+		common.UsingSQLite = true
+		common.RedisEnabled = false
+		config.MemoryCacheEnabled = false
+		maxConcurrency := 1
+		channel := &Channel{Id: 1, Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default", MaxConcurrency: &maxConcurrency}
+		So(DB.Create(channel).Error, ShouldBeNil)
+		So(channel.AddAbilities(), ShouldBeNil)
+		channelSlotsLock.Lock()
+		channelSlots = make(map[int]int)
+		channelSlotsLock.Unlock()
+
+		held, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false, 0)
+		So(err, ShouldBeNil)
+		_, err = CacheGetRandomSatisfiedChannel("default", "gpt-4o", false, 0)
+		So(err, ShouldHaveSameTypeAs, &ChannelBusyError{})
+
+		Convey("serves the waiting requests in the order they arrived", func() {
+			served := make(chan int, 3)
+			var done sync.WaitGroup
+			for i := 1; i <= 3; i++ {
+				done.Add(1)
+				go func(i int) {
+					defer done.Done()
+					channel, err := WaitForSatisfiedChannel(context.Background(), "default", "gpt-4o", 0, 5*time.Second)
+					if err == nil {
+						served <- i
+						time.Sleep(10 * time.Millisecond)
+						ReleaseChannelSlot(channel)
+					}
+				}(i)
+				// lets the request join the queue before the next one
+				time.Sleep(20 * time.Millisecond)
+			}
+			ReleaseChannelSlot(held)
+			var order []int
+			for len(order) < 3 {
+				select {
+				case i := <-served:
+					order = append(order, i)
+				case <-time.After(5 * time.Second):
+					So(order, ShouldHaveLength, 3)
+					return
+				}
+			}
+			So(order, ShouldResemble, []int{1, 2, 3})
+			done.Wait()
+		})
+
+		Convey("gives up with a busy error after the timeout", func() {
+			defer ReleaseChannelSlot(held)
+			start := time.Now()
+			channel, err := WaitForSatisfiedChannel(context.Background(), "default", "gpt-4o", 0, 200*time.Millisecond)
+			So(channel, ShouldBeNil)
+			So(err, ShouldResemble, &ChannelBusyError{QueueTimeout: 200 * time.Millisecond})
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+		})
+
+		Convey("stops waiting when the client goes away", func() {
+			defer ReleaseChannelSlot(held)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := WaitForSatisfiedChannel(ctx, "default", "gpt-4o", 0, 5*time.Second)
+			So(err, ShouldEqual, context.DeadlineExceeded)
+		})
+	})
+}
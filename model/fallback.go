@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelFallbacks maps a group and a model to the models tried in order once every channel of the
+// model has failed, e.g. {"default": {"gpt-4o": ["gpt-4o-mini", "claude-3-5-sonnet-20241022"]}}
+var ModelFallbacks = map[string]map[string][]string{}
+var modelFallbacksLock sync.RWMutex
+
+func ModelFallbacks2JSONString() string {
+	modelFallbacksLock.RLock()
+	defer modelFallbacksLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelFallbacks)
+	if err != nil {
+		logger.SysError("error marshalling model fallbacks: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbacksByJSONString(jsonStr string) error {
+	fallbacks := make(map[string]map[string][]string)
+	err := json.Unmarshal([]byte(jsonStr), &fallbacks)
+	if err != nil {
+		return err
+	}
+	modelFallbacksLock.Lock()
+	defer modelFallbacksLock.Unlock()
+	ModelFallbacks = fallbacks
+	return nil
+}
+
+// GetModelFallbacks returns the fallback chain of the model in the group, without the model itself
+// and without duplicates.
+func GetModelFallbacks(group string, modelName string) []string {
+	modelFallbacksLock.RLock()
+	defer modelFallbacksLock.RUnlock()
+	var fallbacks []string
+	seen := map[string]bool{modelName: true}
+	for _, fallback := range ModelFallbacks[group][modelName] {
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks
+}
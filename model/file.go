@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// IsUploadPurpose tells whether users may upload files with the purpose, the output files of
+// batches are only written by the batch worker.
+func IsUploadPurpose(purpose string) bool {
+	return purpose == FilePurposeBatch
+}
+
+// File is an uploaded file of the files API, the content lives in config.FileStorageDir.
+type File struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Bytes     int64  `json:"bytes" gorm:"bigint"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+// GetFilePath returns where the content of the file with the given id is stored.
+func GetFilePath(id string) string {
+	return filepath.Join(config.FileStorageDir, filepath.Base(id))
+}
+
+func (f *File) Path() string {
+	return GetFilePath(f.Id)
+}
+
+func (f *File) Insert() error {
+	return DB.Create(f).Error
+}
+
+func GetUserFiles(userId int, purpose string) (files []*File, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	err = tx.Order("created_at desc").Find(&files).Error
+	return files, err
+}
+
+func GetFileById(id string, userId int) (*File, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	file := File{}
+	err := DB.First(&file, "id = ? and user_id = ?", id, userId).Error
+	return &file, err
+}
+
+func DeleteFileById(id string, userId int) error {
+	file, err := GetFileById(id, userId)
+	if err != nil {
+		return err
+	}
+	err = DB.Delete(file).Error
+	if err != nil {
+		return err
+	}
+	err = os.Remove(file.Path())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
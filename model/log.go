@@ -24,11 +24,18 @@ type Log struct {
 	Quota             int    `json:"quota" gorm:"default:0"`
 	PromptTokens      int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens  int    `json:"completion_tokens" gorm:"default:0"`
+	CachedTokens      int    `json:"cached_tokens" gorm:"default:0"`
+	CacheWriteTokens  int    `json:"cache_write_tokens" gorm:"default:0"`
+	InputAudioTokens  int    `json:"input_audio_tokens" gorm:"default:0"`
+	ReasoningTokens   int    `json:"reasoning_tokens" gorm:"default:0"`
+	OutputAudioTokens int    `json:"output_audio_tokens" gorm:"default:0"`
+	OutputImageTokens int    `json:"output_image_tokens" gorm:"default:0"`
 	ChannelId         int    `json:"channel" gorm:"index"`
 	RequestId         string `json:"request_id" gorm:"default:''"`
 	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0"` // unit is ms
 	IsStream          bool   `json:"is_stream" gorm:"default:false"`
 	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	Hedged            bool   `json:"hedged" gorm:"default:false"`
 }
 
 const (
@@ -151,12 +151,35 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Redemption{}); err != nil {
 		return err
 	}
+	abilityWeightMissing := !DB.Migrator().HasColumn(&Ability{}, "weight")
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return err
 	}
+	if abilityWeightMissing {
+		// copy the weights of the channels into the new column
+		err = DB.Exec("UPDATE abilities SET weight = COALESCE((SELECT weight FROM channels WHERE channels.id = abilities.channel_id), 0)").Error
+		if err != nil {
+			return err
+		}
+	}
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&Response{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&File{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Batch{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&VideoTask{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ChannelKey{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
@@ -34,6 +34,7 @@ func InitOptionMap() {
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
 	config.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(config.AutomaticEnableChannelEnabled)
+	config.OptionMap["AdaptiveBalancingEnabled"] = strconv.FormatBool(config.AdaptiveBalancingEnabled)
 	config.OptionMap["ApproximateTokenEnabled"] = strconv.FormatBool(config.ApproximateTokenEnabled)
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
@@ -68,12 +69,20 @@ func InitOptionMap() {
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
+	config.OptionMap["ModelPrice"] = billingratio.ModelPrice2JSONString()
+	config.OptionMap["ModelRatioTiers"] = billingratio.ModelRatioTiers2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["CacheReadRatio"] = billingratio.CacheReadRatio2JSONString()
+	config.OptionMap["CacheWriteRatio"] = billingratio.CacheWriteRatio2JSONString()
+	config.OptionMap["ModalityRatio"] = billingratio.ModalityRatio2JSONString()
+	config.OptionMap["ModelFallbacks"] = ModelFallbacks2JSONString()
+	config.OptionMap["ModelAliases"] = ModelAliases2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["HedgeGroups"] = strings.Join(config.HedgeGroups, ",")
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -145,6 +154,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.AutomaticDisableChannelEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
 			config.AutomaticEnableChannelEnabled = boolValue
+		case "AdaptiveBalancingEnabled":
+			config.AdaptiveBalancingEnabled = boolValue
 		case "ApproximateTokenEnabled":
 			config.ApproximateTokenEnabled = boolValue
 		case "LogConsumeEnabled":
@@ -223,12 +234,28 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "HedgeGroups":
+		config.HedgeGroups = strings.Split(value, ",")
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
+	case "ModelPrice":
+		err = billingratio.UpdateModelPriceByJSONString(value)
+	case "ModelRatioTiers":
+		err = billingratio.UpdateModelRatioTiersByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "CacheReadRatio":
+		err = billingratio.UpdateCacheReadRatioByJSONString(value)
+	case "CacheWriteRatio":
+		err = billingratio.UpdateCacheWriteRatioByJSONString(value)
+	case "ModalityRatio":
+		err = billingratio.UpdateModalityRatioByJSONString(value)
+	case "ModelFallbacks":
+		err = UpdateModelFallbacksByJSONString(value)
+	case "ModelAliases":
+		err = UpdateModelAliasesByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
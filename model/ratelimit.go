@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Channels may limit the requests and tokens they serve per minute, for all models and for single
+// models. A request is counted when the channel is picked for it and its tokens once it is done, a
+// channel over its limits is skipped until the minute is over. Channels also learn from the rate limit
+// headers of the upstream, a model which ran out of requests or tokens is skipped until they reset.
+
+// maxRateLimitReset keeps a misread header from taking a channel out for long
+const maxRateLimitReset = time.Hour
+
+type rateWindow struct {
+	minute   int64
+	requests int
+	tokens   int
+}
+
+var rateWindows = make(map[channelStatsKey]*rateWindow)
+var rateLimitedUntil = make(map[channelStatsKey]time.Time)
+var rateWindowsLock sync.Mutex
+
+func getRateWindow(key channelStatsKey, minute int64) *rateWindow {
+	window, ok := rateWindows[key]
+	if !ok || window.minute != minute {
+		window = &rateWindow{minute: minute}
+		rateWindows[key] = window
+	}
+	return window
+}
+
+func (window *rateWindow) exceeds(limit RateLimit) bool {
+	return (limit.RPM > 0 && window.requests >= limit.RPM) || (limit.TPM > 0 && window.tokens >= limit.TPM)
+}
+
+// the keys of a channel share a hash tag so that the script may use them in Redis Cluster
+func rateWindowKey(channelId int, modelName string, kind string, minute int64) string {
+	return fmt.Sprintf("channel_rate:{%d}:%s:%s:%d", channelId, modelName, kind, minute)
+}
+
+func rateLimitedKey(channelId int, modelName string) string {
+	return fmt.Sprintf("channel_rate:{%d}:%s:limited", channelId, modelName)
+}
+
+var acquireChannelBudgetScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+for i = 0, 1 do
+	local rpm, tpm = tonumber(ARGV[1 + i * 2]), tonumber(ARGV[2 + i * 2])
+	if rpm > 0 and tonumber(redis.call('GET', KEYS[2 + i * 2]) or '0') >= rpm then
+		return 0
+	end
+	if tpm > 0 and tonumber(redis.call('GET', KEYS[3 + i * 2]) or '0') >= tpm then
+		return 0
+	end
+end
+for i = 0, 1 do
+	if tonumber(ARGV[1 + i * 2]) > 0 then
+		redis.call('INCR', KEYS[2 + i * 2])
+		redis.call('EXPIRE', KEYS[2 + i * 2], 120)
+	end
+end
+return 1
+`)
+
+// acquireChannelBudget tells whether the channel may serve one more request of the model this
+// minute, and counts the request if so.
+func acquireChannelBudget(channel *Channel, modelName string) bool {
+	now := time.Now()
+	minute := now.Unix() / 60
+	channelLimit, modelLimit := channel.GetRateLimit(), channel.GetModelRateLimit(modelName)
+	if common.RedisEnabled {
+		keys := []string{
+			rateLimitedKey(channel.Id, modelName),
+			rateWindowKey(channel.Id, "", "requests", minute),
+			rateWindowKey(channel.Id, "", "tokens", minute),
+			rateWindowKey(channel.Id, modelName, "requests", minute),
+			rateWindowKey(channel.Id, modelName, "tokens", minute),
+		}
+		acquired, err := acquireChannelBudgetScript.Run(context.Background(), common.RDB, keys,
+			channelLimit.RPM, channelLimit.TPM, modelLimit.RPM, modelLimit.TPM).Int()
+		if err != nil {
+			logger.SysError("failed to check channel rate limit: " + err.Error())
+			return true
+		}
+		return acquired == 1
+	}
+	rateWindowsLock.Lock()
+	defer rateWindowsLock.Unlock()
+	modelKey := channelStatsKey{channelId: channel.Id, model: modelName}
+	if until, ok := rateLimitedUntil[modelKey]; ok {
+		if now.Before(until) {
+			return false
+		}
+		delete(rateLimitedUntil, modelKey)
+	}
+	channelKey := channelStatsKey{channelId: channel.Id}
+	channelWindow, modelWindow := getRateWindow(channelKey, minute), getRateWindow(modelKey, minute)
+	if channelWindow.exceeds(channelLimit) || modelWindow.exceeds(modelLimit) {
+		return false
+	}
+	channelWindow.requests++
+	modelWindow.requests++
+	return true
+}
+
+var releaseChannelBudgetScript = redis.NewScript(`
+for i = 1, 2 do
+	if tonumber(ARGV[i]) > 0 and tonumber(redis.call('GET', KEYS[i]) or '0') > 0 then
+		redis.call('DECR', KEYS[i])
+	end
+end
+return 1
+`)
+
+// ReleaseChannelBudget gives back the request counted when the channel was picked for a request
+// which was not sent to it after all.
+func ReleaseChannelBudget(channel *Channel, modelName string) {
+	channelLimit, modelLimit := channel.GetRateLimit(), channel.GetModelRateLimit(modelName)
+	if channelLimit.RPM <= 0 && modelLimit.RPM <= 0 {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	if common.RedisEnabled {
+		keys := []string{rateWindowKey(channel.Id, "", "requests", minute), rateWindowKey(channel.Id, modelName, "requests", minute)}
+		err := releaseChannelBudgetScript.Run(context.Background(), common.RDB, keys, channelLimit.RPM, modelLimit.RPM).Err()
+		if err != nil {
+			logger.SysError("failed to release channel rate limit: " + err.Error())
+		}
+		return
+	}
+	rateWindowsLock.Lock()
+	defer rateWindowsLock.Unlock()
+	for _, key := range []channelStatsKey{{channelId: channel.Id}, {channelId: channel.Id, model: modelName}} {
+		// the request was counted in a window which is over if the minute has changed
+		if window := getRateWindow(key, minute); window.requests > 0 {
+			window.requests--
+		}
+	}
+}
+
+// RecordChannelTokens counts the tokens of a request against the token limits of the channel.
+func RecordChannelTokens(channel *Channel, modelName string, tokens int) {
+	channelLimit, modelLimit := channel.GetRateLimit(), channel.GetModelRateLimit(modelName)
+	if tokens <= 0 || (channelLimit.TPM <= 0 && modelLimit.TPM <= 0) {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	if common.RedisEnabled {
+		ctx := context.Background()
+		_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range []string{rateWindowKey(channel.Id, "", "tokens", minute), rateWindowKey(channel.Id, modelName, "tokens", minute)} {
+				pipe.IncrBy(ctx, key, int64(tokens))
+				pipe.Expire(ctx, key, 2*time.Minute)
+			}
+			return nil
+		})
+		if err != nil {
+			logger.SysError("failed to record channel tokens: " + err.Error())
+		}
+		return
+	}
+	rateWindowsLock.Lock()
+	defer rateWindowsLock.Unlock()
+	getRateWindow(channelStatsKey{channelId: channel.Id}, minute).tokens += tokens
+	getRateWindow(channelStatsKey{channelId: channel.Id, model: modelName}, minute).tokens += tokens
+}
+
+// parseRateLimitReset reads durations like 1s, 6m0s or 20ms, or a number of seconds.
+func parseRateLimitReset(value string) time.Duration {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// rateLimitReset tells how long the upstream will refuse requests according to the response headers.
+func rateLimitReset(header http.Header) time.Duration {
+	var reset time.Duration
+	if retryAfter := strings.TrimSpace(header.Get("Retry-After")); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			reset = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(retryAfter); err == nil {
+			reset = time.Until(date)
+		}
+	}
+	for _, kind := range []string{"requests", "tokens"} {
+		if strings.TrimSpace(header.Get("X-Ratelimit-Remaining-"+kind)) == "0" {
+			reset = max(reset, parseRateLimitReset(header.Get("X-Ratelimit-Reset-"+kind)))
+		}
+	}
+	return min(reset, maxRateLimitReset)
+}
+
+// LearnChannelRateLimit skips the model on the channel until the rate limit reported by the
+// upstream resets.
+func LearnChannelRateLimit(channelId int, modelName string, header http.Header) {
+	reset := rateLimitReset(header)
+	if reset <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		err := common.RedisSet(rateLimitedKey(channelId, modelName), "1", reset)
+		if err != nil {
+			logger.SysError("failed to record channel rate limit: " + err.Error())
+			return
+		}
+	} else {
+		rateWindowsLock.Lock()
+		rateLimitedUntil[channelStatsKey{channelId: channelId, model: modelName}] = time.Now().Add(reset)
+		rateWindowsLock.Unlock()
+	}
+	logger.SysLog(fmt.Sprintf("channel #%d is rate limited for model %s, skipping it for %s", channelId, modelName, reset))
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestChannelBudget(t *testing.T) {
+	Convey("channel budget", t, func() {
+		common.RedisEnabled = false
+		rpm := 2
+		modelRateLimits := `{"gpt-4o": {"rpm": 1}}`
+		channel := &Channel{Id: 1001, RPMLimit: &rpm, ModelRateLimits: &modelRateLimits}
+		reset := func() {
+			rateWindowsLock.Lock()
+			rateWindows = make(map[channelStatsKey]*rateWindow)
+			rateLimitedUntil = make(map[channelStatsKey]time.Time)
+			rateWindowsLock.Unlock()
+		}
+		reset()
+		defer reset()
+
+		Convey("counts the requests against the limits of the channel and of the model", func() {
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeTrue)
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeFalse)
+			So(acquireChannelBudget(channel, "gpt-4o-mini"), ShouldBeTrue)
+			So(acquireChannelBudget(channel, "gpt-4o-mini"), ShouldBeFalse)
+		})
+
+		Convey("gives back a request which was not sent", func() {
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeTrue)
+			ReleaseChannelBudget(channel, "gpt-4o")
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeTrue)
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeFalse)
+		})
+
+		Convey("never gives back more than was counted", func() {
+			ReleaseChannelBudget(channel, "gpt-4o")
+			ReleaseChannelBudget(channel, "gpt-4o")
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeTrue)
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeFalse)
+		})
+
+		Convey("is not charged when the circuit breaker rejects the channel", func() {
+			config.CircuitBreakerEnabled = true
+			defer func() { config.CircuitBreakerEnabled = false }()
+			circuitBreakersLock.Lock()
+			circuitBreakers[channelStatsKey{channelId: channel.Id, model: "gpt-4o"}] = &circuitBreaker{state: CircuitOpen, since: time.Now().UnixMilli()}
+			circuitBreakersLock.Unlock()
+			defer func() {
+				circuitBreakersLock.Lock()
+				delete(circuitBreakers, channelStatsKey{channelId: channel.Id, model: "gpt-4o"})
+				circuitBreakersLock.Unlock()
+			}()
+			idx, _ := pickChannel([]*Channel{channel}, []uint{1}, "gpt-4o", 0)
+			So(idx, ShouldEqual, -1)
+			So(acquireChannelBudget(channel, "gpt-4o-mini"), ShouldBeTrue)
+			So(acquireChannelBudget(channel, "gpt-4o-mini"), ShouldBeTrue)
+		})
+
+		Convey("gives back the half-open probe when the budget is exhausted", func() {
+			config.CircuitBreakerEnabled = true
+			defer func() { config.CircuitBreakerEnabled = false }()
+			key := channelStatsKey{channelId: channel.Id, model: "gpt-4o"}
+			cooldown := int64(config.CircuitBreakerCooldown) * 1000
+			circuitBreakersLock.Lock()
+			circuitBreakers[key] = &circuitBreaker{state: CircuitOpen, since: time.Now().UnixMilli() - cooldown}
+			circuitBreakersLock.Unlock()
+			defer func() {
+				circuitBreakersLock.Lock()
+				delete(circuitBreakers, key)
+				circuitBreakersLock.Unlock()
+			}()
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeTrue)
+			idx, busy := pickChannel([]*Channel{channel}, []uint{1}, "gpt-4o", 0)
+			So(idx, ShouldEqual, -1)
+			So(busy, ShouldNotBeNil)
+			So(circuitBreakers[key].state, ShouldEqual, CircuitHalfOpen)
+			So(circuitBreakers[key].probes, ShouldEqual, 0)
+			So(acquireCircuit(channel.Id, "gpt-4o"), ShouldBeTrue)
+		})
+
+		Convey("skips a model the upstream reported as rate limited", func() {
+			LearnChannelRateLimit(channel.Id, "gpt-4o", http.Header{"Retry-After": []string{"30"}})
+			So(acquireChannelBudget(channel, "gpt-4o"), ShouldBeFalse)
+			So(acquireChannelBudget(channel, "gpt-4o-mini"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRateLimitReset(t *testing.T) {
+	Convey("rateLimitReset", t, func() {
+		header := func(kv ...string) http.Header {
+			h := http.Header{}
+			for i := 0; i < len(kv); i += 2 {
+				h.Set(kv[i], kv[i+1])
+			}
+			return h
+		}
+
+		Convey("reads Retry-After in seconds and as a date", func() {
+			So(rateLimitReset(header("Retry-After", "20")), ShouldEqual, 20*time.Second)
+			date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+			So(rateLimitReset(header("Retry-After", date)), ShouldBeBetween, 55*time.Second, 61*time.Second)
+		})
+
+		Convey("reads the reset of the exhausted limits only", func() {
+			So(rateLimitReset(header("X-Ratelimit-Remaining-Requests", "0", "X-Ratelimit-Reset-Requests", "6m0s")), ShouldEqual, 6*time.Minute)
+			So(rateLimitReset(header("X-Ratelimit-Remaining-Tokens", "0", "X-Ratelimit-Reset-Tokens", "1.5")), ShouldEqual, 1500*time.Millisecond)
+			So(rateLimitReset(header("X-Ratelimit-Remaining-Requests", "3", "X-Ratelimit-Reset-Requests", "20ms")), ShouldEqual, 0)
+		})
+
+		Convey("takes the longest reset", func() {
+			So(rateLimitReset(header(
+				"Retry-After", "1",
+				"X-Ratelimit-Remaining-Requests", "0", "X-Ratelimit-Reset-Requests", "20ms",
+				"X-Ratelimit-Remaining-Tokens", "0", "X-Ratelimit-Reset-Tokens", "3s",
+			)), ShouldEqual, 3*time.Second)
+		})
+
+		Convey("caps a misread header and ignores garbage", func() {
+			So(rateLimitReset(header("Retry-After", "86400")), ShouldEqual, maxRateLimitReset)
+			So(rateLimitReset(header("Retry-After", "soon")), ShouldEqual, 0)
+		})
+	})
+}
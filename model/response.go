@@ -0,0 +1,39 @@
+package model
+
+import (
+	"errors"
+)
+
+// Response is a stored result of the Responses API, it allows clients to continue
+// a conversation by previous_response_id and to retrieve the response later on.
+type Response struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id"`
+	Model              string `json:"model" gorm:"default:''"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64);default:''"`
+	Messages           string `json:"messages" gorm:"size:16777216"` // chat history up to and including this response
+	Body               string `json:"body" gorm:"size:16777216"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (r *Response) Insert() error {
+	return DB.Create(r).Error
+}
+
+func GetResponseById(id string, userId int) (*Response, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	response := Response{}
+	err := DB.First(&response, "id = ? and user_id = ?", id, userId).Error
+	return &response, err
+}
+
+func DeleteResponseById(id string, userId int) error {
+	response, err := GetResponseById(id, userId)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(response).Error
+}
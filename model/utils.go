@@ -74,5 +74,6 @@ func batchUpdate() {
 			}
 		}
 	}
+	batchUpdateChannelKeyUsage()
 	logger.SysLog("batch update finished")
 }
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"errors"
+)
+
+const (
+	VideoTaskStatusQueued     = "queued"
+	VideoTaskStatusInProgress = "in_progress"
+	VideoTaskStatusCompleted  = "completed"
+	VideoTaskStatusFailed     = "failed"
+)
+
+// VideoTask is a video generation task of the videos API, its quota is pre-consumed on creation
+// and the task is polled by the video task worker of the master node until it finishes.
+type VideoTask struct {
+	Id             string  `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId         int     `json:"user_id" gorm:"index"`
+	TokenId        int     `json:"token_id"`
+	TokenName      string  `json:"token_name"`
+	ChannelId      int     `json:"channel_id"`
+	KeyHash        string  `json:"-" gorm:"type:varchar(16)"` // the key of the channel the task was created with
+	Model          string  `json:"model"`
+	ActualModel    string  `json:"actual_model"`
+	UpstreamTaskId string  `json:"upstream_task_id" gorm:"type:varchar(128)"`
+	Status         string  `json:"status" gorm:"type:varchar(32);index"`
+	Progress       int     `json:"progress" gorm:"default:0"`
+	Prompt         string  `json:"prompt" gorm:"type:text"`
+	Seconds        int     `json:"seconds"`
+	Size           string  `json:"size"`
+	VideoUrl       string  `json:"video_url" gorm:"type:text"`
+	Error          string  `json:"error" gorm:"type:text"`
+	Quota          int64   `json:"quota" gorm:"bigint;default:0"`
+	ModelRatio     float64 `json:"model_ratio"`
+	GroupRatio     float64 `json:"group_ratio"`
+	ModelPrice     float64 `json:"model_price"` // per second in USD, 0 if billed by the model ratio
+	CreatedAt      int64   `json:"created_at" gorm:"bigint"`
+	UpdatedAt      int64   `json:"updated_at" gorm:"bigint"`
+	CompletedAt    int64   `json:"completed_at" gorm:"bigint"`
+}
+
+func (t *VideoTask) Insert() error {
+	return DB.Create(t).Error
+}
+
+func GetUserVideoTaskById(id string, userId int) (*VideoTask, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	task := VideoTask{}
+	err := DB.First(&task, "id = ? and user_id = ?", id, userId).Error
+	return &task, err
+}
+
+// GetUserVideoTasks returns tasks created before the one with id after, newest first.
+func GetUserVideoTasks(userId int, after string, limit int) (tasks []*VideoTask, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		task, err := GetUserVideoTaskById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("created_at < ? or (created_at = ? and id < ?)", task.CreatedAt, task.CreatedAt, task.Id)
+	}
+	err = tx.Order("created_at desc, id desc").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
+// GetUnfinishedVideoTasks returns the tasks the worker still has to poll.
+func GetUnfinishedVideoTasks() (tasks []*VideoTask, err error) {
+	err = DB.Where("status in ?", []string{VideoTaskStatusQueued, VideoTaskStatusInProgress}).Find(&tasks).Error
+	return tasks, err
+}
+
+// UpdateVideoTaskStatus moves the task to status only if it has not finished yet, so that
+// a task is charged or refunded exactly once.
+func UpdateVideoTaskStatus(id string, status string, fields map[string]any) (bool, error) {
+	updates := map[string]any{"status": status}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := DB.Model(&VideoTask{}).
+		Where("id = ? and status in ?", id, []string{VideoTaskStatusQueued, VideoTaskStatusInProgress}).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
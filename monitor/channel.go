@@ -27,8 +27,16 @@ func notifyRootUser(subject string, content string) {
 	}
 }
 
-// DisableChannel disable & notify
-func DisableChannel(channelId int, channelName string, reason string) {
+// DisableChannel disable & notify, only the key is disabled if the channel has other keys left
+func DisableChannel(channelId int, channelName string, key string, reason string) {
+	keyDisabled, remainingKeys, err := model.DisableChannelKey(channelId, key, reason)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable key of channel #%d: %s", channelId, err.Error()))
+	}
+	if keyDisabled && (err != nil || remainingKeys > 0) {
+		disableChannelKey(channelId, channelName, key, remainingKeys, reason)
+		return
+	}
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled: %s", channelId, reason))
 	subject := fmt.Sprintf("渠道状态变更提醒")
@@ -44,6 +52,21 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
+func disableChannelKey(channelId int, channelName string, key string, remainingKeys int, reason string) {
+	logger.SysLog(fmt.Sprintf("key %s of channel #%d has been disabled, %d keys left: %s", model.MaskChannelKey(key), channelId, remainingKeys, reason))
+	subject := fmt.Sprintf("渠道密钥状态变更提醒")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>您好！</p>
+			<p>渠道「<strong>%s</strong>」（#%d）的密钥 %s 已被禁用，该渠道还有 %d 个可用密钥。</p>
+			<p>禁用原因：</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+		`, channelName, channelId, model.MaskChannelKey(key), remainingKeys, reason),
+	)
+	notifyRootUser(subject, content)
+}
+
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
@@ -29,6 +29,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", meta.BaseURL)
 	case relaymode.ImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", meta.BaseURL)
+	case relaymode.Videos:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/video-generation/video-synthesis", meta.BaseURL)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", meta.BaseURL)
 	}
@@ -44,7 +46,7 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 
-	if meta.Mode == relaymode.ImagesGenerations {
+	if meta.Mode == relaymode.ImagesGenerations || meta.Mode == relaymode.Videos {
 		req.Header.Set("X-DashScope-Async", "enable")
 	}
 	if a.meta.Config.Plugin != "" {
@@ -76,6 +78,21 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	return aliRequest, nil
 }
 
+func (a *Adaptor) ConvertVideoRequest(request *model.VideoRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertVideoRequest(*request), nil
+}
+
+func (a *Adaptor) GetVideoTaskURL(meta *meta.Meta, taskId string) (string, error) {
+	return GetVideoTaskURL(meta, taskId), nil
+}
+
+func (a *Adaptor) ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	return ParseVideoTask(resp)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
@@ -0,0 +1,96 @@
+package ali
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://help.aliyun.com/zh/model-studio/developer-reference/video-generation-wanx
+
+type VideoInput struct {
+	Prompt string `json:"prompt"`
+	ImgURL string `json:"img_url,omitempty"`
+}
+
+type VideoParameters struct {
+	Size     string `json:"size,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+type VideoRequest struct {
+	Model      string          `json:"model"`
+	Input      VideoInput      `json:"input"`
+	Parameters VideoParameters `json:"parameters"`
+}
+
+type VideoTaskResponse struct {
+	RequestId string `json:"request_id,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Output    struct {
+		TaskId     string `json:"task_id"`
+		TaskStatus string `json:"task_status"`
+		VideoUrl   string `json:"video_url,omitempty"`
+		Code       string `json:"code,omitempty"`
+		Message    string `json:"message,omitempty"`
+	} `json:"output"`
+}
+
+func ConvertVideoRequest(request model.VideoRequest) *VideoRequest {
+	return &VideoRequest{
+		Model: request.Model,
+		Input: VideoInput{
+			Prompt: request.Prompt,
+			ImgURL: request.ImageURL,
+		},
+		Parameters: VideoParameters{
+			// wanx takes the size as 1280*720
+			Size:     strings.Replace(request.Size, "x", "*", 1),
+			Duration: request.GetSeconds(),
+		},
+	}
+}
+
+func GetVideoTaskURL(meta *meta.Meta, taskId string) string {
+	return fmt.Sprintf("%s/api/v1/tasks/%s", meta.BaseURL, taskId)
+}
+
+func ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	var response VideoTaskResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Code != "" {
+		return nil, fmt.Errorf("%s: %s", response.Code, response.Message)
+	}
+	task := &model.VideoTask{
+		Id:       response.Output.TaskId,
+		VideoURL: response.Output.VideoUrl,
+	}
+	switch response.Output.TaskStatus {
+	case "PENDING":
+		task.Status = model.VideoStatusQueued
+	case "RUNNING":
+		task.Status = model.VideoStatusInProgress
+	case "SUCCEEDED":
+		task.Status = model.VideoStatusCompleted
+	case "FAILED", "CANCELED", "UNKNOWN":
+		task.Status = model.VideoStatusFailed
+		task.Error = response.Output.Message
+	default:
+		task.Status = model.VideoStatusQueued
+	}
+	return task, nil
+}
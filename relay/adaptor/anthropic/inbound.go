@@ -0,0 +1,452 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The functions below run the conversions of main.go in reverse:
+// they let Claude-native clients call /v1/messages, whatever channel serves the request.
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+func errorTypeByStatusCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+func contentBlocks(content any) []Content {
+	switch v := content.(type) {
+	case nil:
+		return nil
+	case string:
+		return []Content{{Type: "text", Text: v}}
+	}
+	var blocks []Content
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(data, &blocks)
+	return blocks
+}
+
+func contentText(content any) string {
+	var text strings.Builder
+	for _, block := range contentBlocks(content) {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
+
+func imageSourceURL(source *ImageSource) string {
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+}
+
+func convertInboundMessage(message InboundMessage) []model.Message {
+	if text, ok := message.Content.(string); ok {
+		return []model.Message{{Role: message.Role, Content: text}}
+	}
+	var messages []model.Message
+	var parts []any
+	var text strings.Builder
+	var toolCalls []model.Tool
+	hasImage := false
+	for _, block := range contentBlocks(message.Content) {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+			parts = append(parts, openai.TextContent{Type: model.ContentTypeText, Text: block.Text})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			hasImage = true
+			parts = append(parts, openai.ImageContent{
+				Type:     model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{Url: imageSourceURL(block.Source)},
+			})
+		case "tool_use":
+			input := block.Input
+			if input == nil {
+				input = map[string]any{}
+			}
+			args, _ := json.Marshal(input)
+			toolCalls = append(toolCalls, model.Tool{
+				Id:   block.Id,
+				Type: "function",
+				Function: model.Function{
+					Name:      block.Name,
+					Arguments: string(args),
+				},
+			})
+		case "tool_result":
+			// tool results must directly follow the assistant message which called the tools
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    contentText(block.Content),
+				ToolCallId: block.ToolUseId,
+			})
+		}
+	}
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return messages
+	}
+	openaiMessage := model.Message{
+		Role:      message.Role,
+		ToolCalls: toolCalls,
+	}
+	if hasImage && message.Role != "assistant" {
+		openaiMessage.Content = parts
+	} else if text.Len() > 0 {
+		openaiMessage.Content = text.String()
+	}
+	return append(messages, openaiMessage)
+}
+
+// ConvertInboundRequest converts a Messages API request into a chat completions request.
+func ConvertInboundRequest(claudeRequest *InboundRequest) *model.GeneralOpenAIRequest {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       claudeRequest.Model,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
+		Stream:      claudeRequest.Stream,
+	}
+	if claudeRequest.Stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		openaiRequest.Stop = claudeRequest.StopSequences
+	}
+	if claudeRequest.Metadata != nil {
+		openaiRequest.User = claudeRequest.Metadata.UserId
+	}
+	if system := contentText(claudeRequest.System); system != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    "system",
+			Content: system,
+		})
+	}
+	for _, message := range claudeRequest.Messages {
+		openaiRequest.Messages = append(openaiRequest.Messages, convertInboundMessage(message)...)
+	}
+	for _, tool := range claudeRequest.Tools {
+		parameters := map[string]any{
+			"type":       tool.InputSchema.Type,
+			"properties": tool.InputSchema.Properties,
+		}
+		if tool.InputSchema.Required != nil {
+			parameters["required"] = tool.InputSchema.Required
+		}
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	if claudeRequest.ToolChoice != nil {
+		switch claudeRequest.ToolChoice.Type {
+		case "any":
+			openaiRequest.ToolChoice = "required"
+		case "none":
+			openaiRequest.ToolChoice = "none"
+		case "tool":
+			openaiRequest.ToolChoice = map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": claudeRequest.ToolChoice.Name,
+				},
+			}
+		default:
+			openaiRequest.ToolChoice = "auto"
+		}
+	}
+	return &openaiRequest
+}
+
+func toolUseContent(tool model.Tool) Content {
+	input := make(map[string]any)
+	_ = json.Unmarshal([]byte(conv.AsString(tool.Function.Arguments)), &input)
+	return Content{
+		Type:  "tool_use",
+		Id:    tool.Id,
+		Name:  tool.Function.Name,
+		Input: input,
+	}
+}
+
+func messageId(openaiId string) string {
+	if openaiId == "" {
+		return "msg_" + random.GetUUID()
+	}
+	return "msg_" + strings.TrimPrefix(openaiId, "chatcmpl-")
+}
+
+func ResponseOpenAI2Claude(openaiResponse *openai.TextResponse) *Response {
+	claudeResponse := Response{
+		Id:      messageId(openaiResponse.Id),
+		Type:    "message",
+		Role:    "assistant",
+		Content: []Content{},
+		Model:   openaiResponse.Model,
+		Usage:   UsageOpenAI2Claude(&openaiResponse.Usage),
+	}
+	if len(openaiResponse.Choices) == 0 {
+		return &claudeResponse
+	}
+	choice := openaiResponse.Choices[0]
+	if text := choice.Message.StringContent(); text != "" {
+		claudeResponse.Content = append(claudeResponse.Content, Content{
+			Type: "text",
+			Text: text,
+		})
+	}
+	for _, tool := range choice.Message.ToolCalls {
+		claudeResponse.Content = append(claudeResponse.Content, toolUseContent(tool))
+	}
+	stopReason := stopReasonOpenAI2Claude(choice.FinishReason)
+	claudeResponse.StopReason = &stopReason
+	return &claudeResponse
+}
+
+type inboundStreamEvent struct {
+	Type         string    `json:"type"`
+	Message      *Response `json:"message,omitempty"`
+	Index        *int      `json:"index,omitempty"`
+	ContentBlock any       `json:"content_block,omitempty"`
+	Delta        any       `json:"delta,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+}
+
+// InboundConverter turns the OpenAI output of the relay pipeline into Messages API responses.
+type InboundConverter struct {
+	modelName    string
+	promptTokens int
+	started      bool
+	blockIndex   int
+	blockType    string
+	toolId       string
+	stopReason   string
+	usage        *model.Usage
+	responseText strings.Builder
+}
+
+func NewInboundConverter(modelName string, promptTokens int) *InboundConverter {
+	return &InboundConverter{
+		modelName:    modelName,
+		promptTokens: promptTokens,
+	}
+}
+
+func (c *InboundConverter) ContentType(stream bool) string {
+	if stream {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (c *InboundConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var openaiResponse openai.TextResponse
+	err := json.Unmarshal(body, &openaiResponse)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ResponseOpenAI2Claude(&openaiResponse))
+}
+
+func (c *InboundConverter) ConvertError(statusCode int, body []byte) []byte {
+	var openaiError struct {
+		Error model.Error `json:"error"`
+	}
+	_ = json.Unmarshal(body, &openaiError)
+	message := openaiError.Error.Message
+	if message == "" {
+		message = string(body)
+	}
+	jsonResponse, _ := json.Marshal(ErrorResponse{
+		Type: "error",
+		Error: Error{
+			Type:    errorTypeByStatusCode(statusCode),
+			Message: message,
+		},
+	})
+	return jsonResponse
+}
+
+func (c *InboundConverter) writeEvent(buf *bytes.Buffer, event inboundStreamEvent) {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		logger.SysError("error marshalling stream event: " + err.Error())
+		return
+	}
+	fmt.Fprintf(buf, "event: %s\ndata: %s\n\n", event.Type, jsonData)
+}
+
+func (c *InboundConverter) start(buf *bytes.Buffer, id string, modelName string) {
+	if c.started {
+		return
+	}
+	c.started = true
+	if modelName == "" {
+		modelName = c.modelName
+	}
+	c.writeEvent(buf, inboundStreamEvent{
+		Type: "message_start",
+		Message: &Response{
+			Id:      messageId(id),
+			Type:    "message",
+			Role:    "assistant",
+			Content: []Content{},
+			Model:   modelName,
+			Usage:   Usage{InputTokens: c.promptTokens},
+		},
+	})
+}
+
+func (c *InboundConverter) startBlock(buf *bytes.Buffer, blockType string, toolId string, block map[string]any) {
+	if c.blockType == blockType && (blockType != "tool_use" || toolId == "" || toolId == c.toolId) {
+		return
+	}
+	c.stopBlock(buf)
+	c.blockType = blockType
+	c.toolId = toolId
+	index := c.blockIndex
+	c.writeEvent(buf, inboundStreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: block,
+	})
+}
+
+func (c *InboundConverter) stopBlock(buf *bytes.Buffer) {
+	if c.blockType == "" {
+		return
+	}
+	index := c.blockIndex
+	c.writeEvent(buf, inboundStreamEvent{
+		Type:  "content_block_stop",
+		Index: &index,
+	})
+	c.blockIndex++
+	c.blockType = ""
+	c.toolId = ""
+}
+
+func (c *InboundConverter) delta(buf *bytes.Buffer, delta map[string]any) {
+	index := c.blockIndex
+	c.writeEvent(buf, inboundStreamEvent{
+		Type:  "content_block_delta",
+		Index: &index,
+		Delta: delta,
+	})
+}
+
+func (c *InboundConverter) ConvertStreamData(data string) []byte {
+	var streamResponse openai.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	var buf bytes.Buffer
+	c.start(&buf, streamResponse.Id, streamResponse.Model)
+	if streamResponse.Usage != nil {
+		c.usage = streamResponse.Usage
+	}
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			c.startBlock(&buf, "text", "", map[string]any{"type": "text", "text": ""})
+			c.delta(&buf, map[string]any{"type": "text_delta", "text": text})
+			c.responseText.WriteString(text)
+		}
+		for _, tool := range choice.Delta.ToolCalls {
+			if tool.Id != "" || c.blockType != "tool_use" {
+				c.startBlock(&buf, "tool_use", tool.Id, map[string]any{
+					"type":  "tool_use",
+					"id":    tool.Id,
+					"name":  tool.Function.Name,
+					"input": map[string]any{},
+				})
+			}
+			if args := conv.AsString(tool.Function.Arguments); args != "" {
+				c.delta(&buf, map[string]any{"type": "input_json_delta", "partial_json": args})
+				c.responseText.WriteString(args)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *InboundConverter) FinishStream(usage *model.Usage) []byte {
+	var buf bytes.Buffer
+	c.start(&buf, "", "")
+	c.stopBlock(&buf)
+	if usage == nil {
+		usage = c.usage
+	}
+	if usage == nil {
+		usage = openai.ResponseText2Usage(c.responseText.String(), c.modelName, c.promptTokens)
+	}
+	stopReason := c.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	claudeUsage := UsageOpenAI2Claude(usage)
+	c.writeEvent(&buf, inboundStreamEvent{
+		Type: "message_delta",
+		Delta: map[string]any{
+			"stop_reason":   stopReason,
+			"stop_sequence": nil,
+		},
+		Usage: &claudeUsage,
+	})
+	c.writeEvent(&buf, inboundStreamEvent{Type: "message_stop"})
+	return buf.Bytes()
+}
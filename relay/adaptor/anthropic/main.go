@@ -73,8 +73,8 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 				claudeToolChoice.Name = function["name"].(string)
 			}
 		} else if toolChoiceType, ok := textRequest.ToolChoice.(string); ok {
-			if toolChoiceType == "any" {
-				claudeToolChoice.Type = toolChoiceType
+			if toolChoiceType == "any" || toolChoiceType == "required" {
+				claudeToolChoice.Type = "any"
 			}
 		}
 		claudeRequest.ToolChoice = claudeToolChoice
@@ -264,7 +264,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	common.SetEventStreamHeaders(c)
 
-	var usage model.Usage
+	var claudeUsage Usage
 	var modelName string
 	var id string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
@@ -286,8 +286,11 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 		response, meta := StreamResponseClaude2OpenAI(&claudeResponse)
 		if meta != nil {
-			usage.PromptTokens += meta.Usage.InputTokens
-			usage.CompletionTokens += meta.Usage.OutputTokens
+			// message_start has the input tokens, the counts of message_delta are cumulative
+			claudeUsage.InputTokens = max(claudeUsage.InputTokens, meta.Usage.InputTokens)
+			claudeUsage.OutputTokens = max(claudeUsage.OutputTokens, meta.Usage.OutputTokens)
+			claudeUsage.CacheCreationInputTokens = max(claudeUsage.CacheCreationInputTokens, meta.Usage.CacheCreationInputTokens)
+			claudeUsage.CacheReadInputTokens = max(claudeUsage.CacheReadInputTokens, meta.Usage.CacheReadInputTokens)
 			if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 				modelName = meta.Model
 				id = fmt.Sprintf("chatcmpl-%s", meta.Id)
@@ -332,9 +335,34 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	if err != nil {
 		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
 	}
+	usage := UsageClaude2OpenAI(&claudeUsage)
 	return nil, &usage
 }
 
+// UsageClaude2OpenAI converts the usage of Claude, whose input tokens leave out the cached ones, to
+// the OpenAI one whose prompt tokens include them.
+func UsageClaude2OpenAI(claudeUsage *Usage) model.Usage {
+	promptTokens := claudeUsage.InputTokens + claudeUsage.CacheReadInputTokens + claudeUsage.CacheCreationInputTokens
+	usage := model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: claudeUsage.OutputTokens,
+		TotalTokens:      promptTokens + claudeUsage.OutputTokens,
+	}
+	usage.SetCacheTokens(claudeUsage.CacheReadInputTokens, claudeUsage.CacheCreationInputTokens)
+	return usage
+}
+
+// UsageOpenAI2Claude is the reverse of UsageClaude2OpenAI.
+func UsageOpenAI2Claude(usage *model.Usage) Usage {
+	cachedTokens, cacheWriteTokens := usage.GetCachedTokens(), usage.GetCacheWriteTokens()
+	return Usage{
+		InputTokens:              max(usage.PromptTokens-cachedTokens-cacheWriteTokens, 0),
+		OutputTokens:             usage.CompletionTokens,
+		CacheCreationInputTokens: cacheWriteTokens,
+		CacheReadInputTokens:     cachedTokens,
+	}
+}
+
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -349,7 +377,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	if err != nil {
 		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
-	if claudeResponse.Error.Type != "" {
+	if claudeResponse.Error != nil && claudeResponse.Error.Type != "" {
 		return &model.ErrorWithStatusCode{
 			Error: model.Error{
 				Message: claudeResponse.Error.Message,
@@ -362,11 +390,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := ResponseClaude2OpenAI(&claudeResponse)
 	fullTextResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := UsageClaude2OpenAI(&claudeResponse.Usage)
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
@@ -10,6 +10,7 @@ type ImageSource struct {
 	Type      string `json:"type"`
 	MediaType string `json:"media_type"`
 	Data      string `json:"data"`
+	Url       string `json:"url,omitempty"`
 }
 
 type Content struct {
@@ -20,8 +21,9 @@ type Content struct {
 	Id        string `json:"id,omitempty"`
 	Name      string `json:"name,omitempty"`
 	Input     any    `json:"input,omitempty"`
-	Content   string `json:"content,omitempty"`
+	Content   any    `json:"content,omitempty"`
 	ToolUseId string `json:"tool_use_id,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 type Message struct {
@@ -56,9 +58,12 @@ type Request struct {
 	//Metadata    `json:"metadata,omitempty"`
 }
 
+// Usage counts the input tokens read from or written to the prompt cache apart from the others.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 type Error struct {
@@ -75,7 +80,7 @@ type Response struct {
 	StopReason   *string   `json:"stop_reason"`
 	StopSequence *string   `json:"stop_sequence"`
 	Usage        Usage     `json:"usage"`
-	Error        Error     `json:"error"`
+	Error        *Error    `json:"error,omitempty"`
 }
 
 type Delta struct {
@@ -94,3 +99,39 @@ type StreamResponse struct {
 	Delta        *Delta    `json:"delta"`
 	Usage        *Usage    `json:"usage"`
 }
+
+// InboundRequest is a Messages API request sent by a Claude-native client,
+// system and message content may be either a plain string or a list of blocks.
+type InboundRequest struct {
+	Model         string           `json:"model"`
+	Messages      []InboundMessage `json:"messages"`
+	System        any              `json:"system,omitempty"`
+	MaxTokens     int              `json:"max_tokens,omitempty"`
+	StopSequences []string         `json:"stop_sequences,omitempty"`
+	Stream        bool             `json:"stream,omitempty"`
+	Temperature   *float64         `json:"temperature,omitempty"`
+	TopP          *float64         `json:"top_p,omitempty"`
+	TopK          int              `json:"top_k,omitempty"`
+	Tools         []Tool           `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice      `json:"tool_choice,omitempty"`
+	Metadata      *Metadata        `json:"metadata,omitempty"`
+}
+
+type InboundMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
+
+type CountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
@@ -224,7 +224,13 @@ func handleInvokeModelRequest(c *gin.Context, awsCli *bedrockruntime.Client, req
 		if outputTokens, ok := usageInfo["output_tokens"].(float64); ok {
 			usage.CompletionTokens = int(outputTokens)
 		}
+		// the input tokens of Anthropic leave out those read from or written to the prompt cache
+		cacheReadTokens, _ := usageInfo["cache_read_input_tokens"].(float64)
+		cacheWriteTokens, _ := usageInfo["cache_creation_input_tokens"].(float64)
+		usage.PromptTokens += int(cacheReadTokens) + int(cacheWriteTokens)
+		usage.SetCacheTokens(int(cacheReadTokens), int(cacheWriteTokens))
 		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		openaiResponse["usage"] = usage
 	}
 
 	c.JSON(http.StatusOK, openaiResponse)
@@ -523,6 +529,10 @@ func processInvokeModelStreamResponse(c *gin.Context, stream *bedrockruntime.Inv
 						if outputTokens, ok := metrics["outputTokenCount"].(float64); ok {
 							usage.CompletionTokens = int(outputTokens)
 						}
+						cacheReadTokens, _ := metrics["cacheReadInputTokenCount"].(float64)
+						cacheWriteTokens, _ := metrics["cacheWriteInputTokenCount"].(float64)
+						usage.PromptTokens += int(cacheReadTokens) + int(cacheWriteTokens)
+						usage.SetCacheTokens(int(cacheReadTokens), int(cacheWriteTokens))
 						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 					}
 				}
@@ -74,6 +74,18 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 	return &cohereRequest
 }
 
+// ConvertRerankRequest only flattens the documents, the rerank response of Cohere is already the unified one.
+func ConvertRerankRequest(request *model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.DocumentTexts(),
+		TopN:            request.TopN,
+		ReturnDocuments: request.ReturnDocuments,
+		MaxChunksPerDoc: request.MaxChunksPerDoc,
+	}
+}
+
 func StreamResponseCohere2OpenAI(cohereResponse *StreamResponse) (*openai.ChatCompletionsStreamResponse, *Response) {
 	var response *Response
 	var responseText string
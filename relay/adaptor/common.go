@@ -1,10 +1,12 @@
 package adaptor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"io"
 	"net/http"
@@ -31,8 +33,14 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	// a hedged request is cancelled once the other request of the hedge has answered
+	if ctx, ok := c.Get(ctxkey.UpstreamContext); ok && ctx != nil {
+		req = req.WithContext(ctx.(context.Context))
+	}
 	resp, err := DoRequest(c, req)
 	if err != nil {
+		// the channel is unreachable
+		c.Set(ctxkey.UpstreamError, true)
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
 	return resp, nil
@@ -46,6 +54,11 @@ func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	// for the rate limits reported by the upstream
+	c.Set(ctxkey.UpstreamHeader, resp.Header)
+	if resp.StatusCode/100 != 2 {
+		c.Set(ctxkey.UpstreamError, true)
+	}
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
@@ -12,6 +12,8 @@ func GetRequestURL(meta *meta.Meta) (string, error) {
 		return fmt.Sprintf("%s/api/v3/chat/completions", meta.BaseURL), nil
 	case relaymode.Embeddings:
 		return fmt.Sprintf("%s/api/v3/embeddings", meta.BaseURL), nil
+	case relaymode.Videos:
+		return fmt.Sprintf("%s/api/v3/contents/generations/tasks", meta.BaseURL), nil
 	default:
 	}
 	return "", fmt.Errorf("unsupported relay mode %d for doubao", meta.Mode)
@@ -0,0 +1,105 @@
+package doubao
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://www.volcengine.com/docs/82379/1520757
+
+type VideoImageURL struct {
+	Url string `json:"url"`
+}
+
+type VideoContent struct {
+	Type     string         `json:"type"`
+	Text     string         `json:"text,omitempty"`
+	ImageURL *VideoImageURL `json:"image_url,omitempty"`
+}
+
+type VideoRequest struct {
+	Model   string         `json:"model"`
+	Content []VideoContent `json:"content"`
+}
+
+type VideoTaskResponse struct {
+	Id      string `json:"id"`
+	Status  string `json:"status"`
+	Content struct {
+		VideoUrl string `json:"video_url"`
+	} `json:"content"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// ConvertVideoRequest appends the generation parameters to the prompt as text commands.
+func ConvertVideoRequest(request model.VideoRequest) *VideoRequest {
+	text := fmt.Sprintf("%s --duration %d", request.Prompt, request.GetSeconds())
+	switch {
+	case strings.HasSuffix(request.Size, "p"):
+		text += " --resolution " + request.Size
+	case strings.Contains(request.Size, ":"):
+		text += " --ratio " + request.Size
+	}
+	videoRequest := &VideoRequest{
+		Model: request.Model,
+		Content: []VideoContent{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
+	if request.ImageURL != "" {
+		videoRequest.Content = append(videoRequest.Content, VideoContent{
+			Type:     "image_url",
+			ImageURL: &VideoImageURL{Url: request.ImageURL},
+		})
+	}
+	return videoRequest
+}
+
+func GetVideoTaskURL(meta *meta.Meta, taskId string) string {
+	return fmt.Sprintf("%s/api/v3/contents/generations/tasks/%s", meta.BaseURL, taskId)
+}
+
+func ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	var response VideoTaskResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	task := &model.VideoTask{
+		Id:       response.Id,
+		VideoURL: response.Content.VideoUrl,
+	}
+	switch response.Status {
+	case "running":
+		task.Status = model.VideoStatusInProgress
+	case "succeeded":
+		task.Status = model.VideoStatusCompleted
+	case "failed", "cancelled":
+		task.Status = model.VideoStatusFailed
+		task.Error = response.Status
+		if response.Error != nil {
+			task.Error = response.Error.Message
+		}
+	default:
+		// the creation response only carries the id
+		task.Status = model.VideoStatusQueued
+	}
+	return task, nil
+}
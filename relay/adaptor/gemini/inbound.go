@@ -0,0 +1,485 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The functions below run the conversions of main.go in reverse: they let clients of the
+// Google GenAI SDK call /v1beta/models/{model}:generateContent, whatever channel serves the request.
+
+type FunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+type InboundTool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+// InboundRequest is the request body of generateContent as sent by Gemini clients.
+type InboundRequest struct {
+	Contents          []ChatContent         `json:"contents"`
+	SystemInstruction *ChatContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *ChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []InboundTool         `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig           `json:"toolConfig,omitempty"`
+	SafetySettings    []ChatSafetySettings  `json:"safetySettings,omitempty"`
+}
+
+type CountTokensRequest struct {
+	Contents               []ChatContent   `json:"contents,omitempty"`
+	GenerateContentRequest *InboundRequest `json:"generateContentRequest,omitempty"`
+}
+
+type CountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func errorStatusByStatusCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+// ErrorBody builds a Gemini style error body.
+func ErrorBody(statusCode int, message string) []byte {
+	jsonResponse, _ := json.Marshal(ErrorResponse{
+		Error: Error{
+			Code:    statusCode,
+			Message: message,
+			Status:  errorStatusByStatusCode(statusCode),
+		},
+	})
+	return jsonResponse
+}
+
+// schemaGemini2OpenAI lowercases the OpenAPI style types ("OBJECT", "STRING") of Gemini schemas,
+// JSON schema only knows the lowercase ones.
+func schemaGemini2OpenAI(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, value := range v {
+			if typ, ok := value.(string); ok && key == "type" {
+				converted[key] = strings.ToLower(typ)
+				continue
+			}
+			converted[key] = schemaGemini2OpenAI(value)
+		}
+		return converted
+	case []any:
+		converted := make([]any, 0, len(v))
+		for _, value := range v {
+			converted = append(converted, schemaGemini2OpenAI(value))
+		}
+		return converted
+	default:
+		return schema
+	}
+}
+
+func partsText(parts []Part) string {
+	var text strings.Builder
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+type inboundConversion struct {
+	messages []model.Message
+	// ids of function calls that have not been answered yet, by function name
+	pendingCallIds map[string][]string
+}
+
+func (ic *inboundConversion) addContent(content ChatContent) {
+	role := "user"
+	if content.Role == "model" {
+		role = "assistant"
+	}
+	var contentList []any
+	var toolCalls []model.Tool
+	hasImage := false
+	for _, part := range content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			id := fmt.Sprintf("call_%s", random.GetUUID())
+			ic.pendingCallIds[part.FunctionCall.FunctionName] = append(ic.pendingCallIds[part.FunctionCall.FunctionName], id)
+			arguments, _ := json.Marshal(part.FunctionCall.Arguments)
+			toolCalls = append(toolCalls, model.Tool{
+				Id:   id,
+				Type: "function",
+				Function: model.Function{
+					Name:      part.FunctionCall.FunctionName,
+					Arguments: string(arguments),
+				},
+			})
+		case part.FunctionResponse != nil:
+			name := part.FunctionResponse.Name
+			id := fmt.Sprintf("call_%s", random.GetUUID())
+			if ids := ic.pendingCallIds[name]; len(ids) > 0 {
+				id = ids[0]
+				ic.pendingCallIds[name] = ids[1:]
+			}
+			response, _ := json.Marshal(part.FunctionResponse.Response)
+			ic.messages = append(ic.messages, model.Message{
+				Role:       "tool",
+				Content:    string(response),
+				ToolCallId: id,
+			})
+		case part.InlineData != nil:
+			hasImage = true
+			contentList = append(contentList, openai.ImageContent{
+				Type: model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{
+					Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+				},
+			})
+		case part.Text != "":
+			contentList = append(contentList, openai.TextContent{
+				Type: model.ContentTypeText,
+				Text: part.Text,
+			})
+		}
+	}
+	message := model.Message{
+		Role:      role,
+		ToolCalls: toolCalls,
+	}
+	if hasImage {
+		message.Content = contentList
+	} else if text := partsText(content.Parts); text != "" {
+		message.Content = text
+	}
+	if message.Content == nil && len(message.ToolCalls) == 0 {
+		return
+	}
+	ic.messages = append(ic.messages, message)
+}
+
+func ConvertInboundRequest(modelName string, request *InboundRequest, stream bool) *model.GeneralOpenAIRequest {
+	textRequest := model.GeneralOpenAIRequest{
+		Model:  modelName,
+		Stream: stream,
+	}
+	if stream {
+		textRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if request.SystemInstruction != nil {
+		if system := partsText(request.SystemInstruction.Parts); system != "" {
+			textRequest.Messages = append(textRequest.Messages, model.Message{
+				Role:    "system",
+				Content: system,
+			})
+		}
+	}
+	conversion := inboundConversion{
+		messages:       textRequest.Messages,
+		pendingCallIds: make(map[string][]string),
+	}
+	for _, content := range request.Contents {
+		conversion.addContent(content)
+	}
+	textRequest.Messages = conversion.messages
+	if config := request.GenerationConfig; config != nil {
+		textRequest.Temperature = config.Temperature
+		textRequest.TopP = config.TopP
+		textRequest.TopK = int(config.TopK)
+		textRequest.MaxTokens = config.MaxOutputTokens
+		if len(config.StopSequences) > 0 {
+			textRequest.Stop = config.StopSequences
+		}
+		if config.ResponseMimeType == "application/json" {
+			textRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+			if schema, ok := schemaGemini2OpenAI(config.ResponseSchema).(map[string]any); ok {
+				textRequest.ResponseFormat = &model.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &model.JSONSchema{
+						Name:   "response",
+						Schema: schema,
+					},
+				}
+			}
+		}
+	}
+	for _, tool := range request.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			parameters := declaration.ParametersJsonSchema
+			if parameters == nil {
+				parameters = schemaGemini2OpenAI(declaration.Parameters)
+			}
+			textRequest.Tools = append(textRequest.Tools, model.Tool{
+				Type: "function",
+				Function: model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := request.ToolConfig.FunctionCallingConfig
+		switch callingConfig.Mode {
+		case "NONE":
+			textRequest.ToolChoice = "none"
+		case "ANY":
+			textRequest.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				textRequest.ToolChoice = map[string]any{
+					"type": "function",
+					"function": map[string]any{
+						"name": callingConfig.AllowedFunctionNames[0],
+					},
+				}
+			}
+		case "AUTO":
+			textRequest.ToolChoice = "auto"
+		}
+	}
+	return &textRequest
+}
+
+func functionCallPart(tool model.Tool) Part {
+	var args any
+	if err := json.Unmarshal([]byte(conv.AsString(tool.Function.Arguments)), &args); err != nil || args == nil {
+		args = map[string]any{}
+	}
+	return Part{
+		FunctionCall: &FunctionCall{
+			FunctionName: tool.Function.Name,
+			Arguments:    args,
+		},
+	}
+}
+
+func usageMetadata(usage *model.Usage) *UsageMetadata {
+	return &UsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens - usage.GetReasoningTokens(),
+		TotalTokenCount:         usage.PromptTokens + usage.CompletionTokens,
+		CachedContentTokenCount: usage.GetCachedTokens(),
+		ThoughtsTokenCount:      usage.GetReasoningTokens(),
+	}
+}
+
+func ResponseOpenAI2Gemini(openaiResponse *openai.TextResponse) *ChatResponse {
+	geminiResponse := ChatResponse{
+		Candidates:    make([]ChatCandidate, 0, len(openaiResponse.Choices)),
+		UsageMetadata: usageMetadata(&openaiResponse.Usage),
+		ModelVersion:  openaiResponse.Model,
+	}
+	for _, choice := range openaiResponse.Choices {
+		candidate := ChatCandidate{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: []Part{},
+			},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        int64(choice.Index),
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: text})
+		}
+		for _, tool := range choice.Message.ToolCalls {
+			candidate.Content.Parts = append(candidate.Content.Parts, functionCallPart(tool))
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+	}
+	return &geminiResponse
+}
+
+// InboundConverter turns the chat completions output of the relay pipeline into generateContent responses.
+// Streams are sent as server-sent events with alt=sse, and as a JSON array otherwise.
+type InboundConverter struct {
+	modelName    string
+	promptTokens int
+	sse          bool
+
+	started      bool
+	responseText strings.Builder
+	toolCalls    []model.Tool
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewInboundConverter(modelName string, promptTokens int, sse bool) *InboundConverter {
+	return &InboundConverter{
+		modelName:    modelName,
+		promptTokens: promptTokens,
+		sse:          sse,
+	}
+}
+
+func (c *InboundConverter) ContentType(stream bool) string {
+	if stream && c.sse {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (c *InboundConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var openaiResponse openai.TextResponse
+	err := json.Unmarshal(body, &openaiResponse)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ResponseOpenAI2Gemini(&openaiResponse))
+}
+
+func (c *InboundConverter) ConvertError(statusCode int, body []byte) []byte {
+	var openaiError struct {
+		Error model.Error `json:"error"`
+	}
+	_ = json.Unmarshal(body, &openaiError)
+	message := openaiError.Error.Message
+	if message == "" {
+		message = string(body)
+	}
+	return ErrorBody(statusCode, message)
+}
+
+func (c *InboundConverter) writeChunk(buf *bytes.Buffer, response *ChatResponse) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	if c.sse {
+		fmt.Fprintf(buf, "data: %s\r\n\r\n", jsonData)
+		return
+	}
+	if c.started {
+		buf.WriteString(",\r\n")
+	} else {
+		buf.WriteString("[")
+	}
+	c.started = true
+	buf.Write(jsonData)
+}
+
+func (c *InboundConverter) ConvertStreamData(data string) []byte {
+	var streamResponse openai.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	if streamResponse.Usage != nil {
+		c.usage = streamResponse.Usage
+	}
+	var buf bytes.Buffer
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			c.responseText.WriteString(text)
+			c.writeChunk(&buf, &ChatResponse{
+				Candidates: []ChatCandidate{{
+					Content: ChatContent{
+						Role:  "model",
+						Parts: []Part{{Text: text}},
+					},
+				}},
+				ModelVersion: c.modelName,
+			})
+		}
+		// function calls are sent as a whole once their arguments are complete
+		for _, tool := range choice.Delta.ToolCalls {
+			if tool.Id != "" || len(c.toolCalls) == 0 {
+				c.toolCalls = append(c.toolCalls, model.Tool{
+					Id:       tool.Id,
+					Type:     "function",
+					Function: model.Function{Name: tool.Function.Name},
+				})
+			}
+			last := &c.toolCalls[len(c.toolCalls)-1]
+			last.Function.Arguments = conv.AsString(last.Function.Arguments) + conv.AsString(tool.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *InboundConverter) FinishStream(usage *model.Usage) []byte {
+	var buf bytes.Buffer
+	if usage == nil {
+		usage = c.usage
+	}
+	if usage == nil {
+		usage = openai.ResponseText2Usage(c.responseText.String(), c.modelName, c.promptTokens)
+	}
+	candidate := ChatCandidate{
+		Content: ChatContent{
+			Role:  "model",
+			Parts: []Part{},
+		},
+		FinishReason: finishReasonOpenAI2Gemini(c.finishReason),
+	}
+	for _, tool := range c.toolCalls {
+		candidate.Content.Parts = append(candidate.Content.Parts, functionCallPart(tool))
+	}
+	if len(candidate.Content.Parts) == 0 {
+		candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: ""})
+	}
+	c.writeChunk(&buf, &ChatResponse{
+		Candidates:    []ChatCandidate{candidate},
+		UsageMetadata: usageMetadata(usage),
+		ModelVersion:  c.modelName,
+	})
+	if !c.sse {
+		buf.WriteString("]")
+	}
+	return buf.Bytes()
+}
@@ -185,8 +185,64 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 }
 
 type ChatResponse struct {
-	Candidates     []ChatCandidate    `json:"candidates"`
-	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	Candidates     []ChatCandidate     `json:"candidates"`
+	PromptFeedback *ChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata      `json:"usageMetadata,omitempty"`
+	ModelVersion   string              `json:"modelVersion,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount        int                  `json:"promptTokenCount"`
+	CandidatesTokenCount    int                  `json:"candidatesTokenCount"`
+	TotalTokenCount         int                  `json:"totalTokenCount"`
+	CachedContentTokenCount int                  `json:"cachedContentTokenCount,omitempty"`
+	ThoughtsTokenCount      int                  `json:"thoughtsTokenCount,omitempty"`
+	PromptTokensDetails     []ModalityTokenCount `json:"promptTokensDetails,omitempty"`
+	CandidatesTokensDetails []ModalityTokenCount `json:"candidatesTokensDetails,omitempty"`
+}
+
+type ModalityTokenCount struct {
+	Modality   string `json:"modality"`
+	TokenCount int    `json:"tokenCount"`
+}
+
+func modalityTokens(details []ModalityTokenCount, modality string) int {
+	for _, detail := range details {
+		if detail.Modality == modality {
+			return detail.TokenCount
+		}
+	}
+	return 0
+}
+
+// toUsage converts the usage reported by Gemini, nil if it reported none. The prompt tokens include
+// the cached ones and the completion tokens the thoughts.
+func (m *UsageMetadata) toUsage() *model.Usage {
+	if m == nil || m.PromptTokenCount == 0 {
+		return nil
+	}
+	completionTokens := m.CandidatesTokenCount + m.ThoughtsTokenCount
+	usage := &model.Usage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: completionTokens,
+		TotalTokens:      m.PromptTokenCount + completionTokens,
+	}
+	usage.SetCacheTokens(m.CachedContentTokenCount, 0)
+	if audioTokens := modalityTokens(m.PromptTokensDetails, "AUDIO"); audioTokens > 0 {
+		if usage.PromptTokensDetails == nil {
+			usage.PromptTokensDetails = &model.PromptTokensDetails{}
+		}
+		usage.PromptTokensDetails.AudioTokens = audioTokens
+	}
+	completionDetails := model.CompletionTokensDetails{
+		ReasoningTokens: m.ThoughtsTokenCount,
+		AudioTokens:     modalityTokens(m.CandidatesTokensDetails, "AUDIO"),
+		ImageTokens:     modalityTokens(m.CandidatesTokensDetails, "IMAGE"),
+	}
+	if completionDetails != (model.CompletionTokensDetails{}) {
+		usage.CompletionTokensDetails = &completionDetails
+	}
+	return usage
 }
 
 func (g *ChatResponse) GetResponseText() string {
@@ -201,9 +257,9 @@ func (g *ChatResponse) GetResponseText() string {
 
 type ChatCandidate struct {
 	Content       ChatContent        `json:"content"`
-	FinishReason  string             `json:"finishReason"`
+	FinishReason  string             `json:"finishReason,omitempty"`
 	Index         int64              `json:"index"`
-	SafetyRatings []ChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []ChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type ChatSafetyRating struct {
@@ -306,8 +362,9 @@ func embeddingResponseGemini2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string) {
+func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	responseText := ""
+	var usage *model.Usage
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
 
@@ -329,6 +386,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			continue
 		}
 
+		// every chunk reports the usage so far
+		if chunkUsage := geminiResponse.UsageMetadata.toUsage(); chunkUsage != nil {
+			usage = chunkUsage
+		}
 		response := streamResponseGeminiChat2OpenAI(&geminiResponse)
 		if response == nil {
 			continue
@@ -350,10 +411,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	err := resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
 	}
 
-	return nil, responseText
+	return nil, responseText, usage
 }
 
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
@@ -383,11 +444,16 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
 	fullTextResponse.Model = modelName
-	completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
-	usage := model.Usage{
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      promptTokens + completionTokens,
+	var usage model.Usage
+	if reportedUsage := geminiResponse.UsageMetadata.toUsage(); reportedUsage != nil {
+		usage = *reportedUsage
+	} else {
+		completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
+		usage = model.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
 	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
@@ -19,3 +19,17 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor is implemented by the adaptors whose upstream can serve /v1/rerank.
+type RerankAdaptor interface {
+	ConvertRerankRequest(request *model.RerankRequest) (any, error)
+}
+
+// VideoAdaptor is implemented by the adaptors whose upstream can serve /v1/videos. The task is
+// created with GetRequestURL and DoRequest in the videos relay mode, then polled with GetVideoTaskURL.
+// ParseVideoTask reads both the creation and the polling responses.
+type VideoAdaptor interface {
+	ConvertVideoRequest(request *model.VideoRequest) (any, error)
+	GetVideoTaskURL(meta *meta.Meta, taskId string) (string, error)
+	ParseVideoTask(resp *http.Response) (*model.VideoTask, error)
+}
@@ -23,8 +23,11 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	// https://github.com/ollama/ollama/blob/main/docs/api.md
 	fullRequestURL := fmt.Sprintf("%s/api/chat", meta.BaseURL)
-	if meta.Mode == relaymode.Embeddings {
+	switch meta.Mode {
+	case relaymode.Embeddings:
 		fullRequestURL = fmt.Sprintf("%s/api/embed", meta.BaseURL)
+	case relaymode.FimCompletions:
+		fullRequestURL = fmt.Sprintf("%s/api/generate", meta.BaseURL)
 	}
 	return fullRequestURL, nil
 }
@@ -43,6 +46,8 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	case relaymode.Embeddings:
 		ollamaEmbeddingRequest := ConvertEmbeddingRequest(*request)
 		return ollamaEmbeddingRequest, nil
+	case relaymode.FimCompletions:
+		return ConvertFimRequest(*request), nil
 	default:
 		return ConvertRequest(*request), nil
 	}
@@ -0,0 +1,411 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The functions below run the conversions of main.go in reverse: they let Ollama clients
+// call /api/chat, /api/generate and /api/embed, whatever channel serves the request.
+
+// InboundChatRequest overrides the stream flag of ChatRequest, Ollama streams unless told otherwise.
+type InboundChatRequest struct {
+	ChatRequest
+	Stream *bool `json:"stream,omitempty"`
+}
+
+type InboundEmbeddingRequest struct {
+	Model   string   `json:"model"`
+	Input   any      `json:"input"`
+	Options *Options `json:"options,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func IsStream(stream *bool) bool {
+	return stream == nil || *stream
+}
+
+func ErrorBody(message string) []byte {
+	jsonData, _ := json.Marshal(ErrorResponse{Error: message})
+	return jsonData
+}
+
+// errorBodyOpenAI2Ollama converts an OpenAI style error body.
+func errorBodyOpenAI2Ollama(body []byte) []byte {
+	var openaiError struct {
+		Error model.Error `json:"error"`
+	}
+	_ = json.Unmarshal(body, &openaiError)
+	message := openaiError.Error.Message
+	if message == "" {
+		message = string(body)
+	}
+	return ErrorBody(message)
+}
+
+// imageDataURL turns the bare base64 images of Ollama into data urls.
+func imageDataURL(data string) string {
+	mimeType := "image/jpeg"
+	if decoded, err := base64.StdEncoding.DecodeString(data[:min(len(data), 512)/4*4]); err == nil {
+		if detected := http.DetectContentType(decoded); strings.HasPrefix(detected, "image/") {
+			mimeType = detected
+		}
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, data)
+}
+
+func messageContent(text string, images []string) any {
+	if len(images) == 0 {
+		return text
+	}
+	var contentList []any
+	if text != "" {
+		contentList = append(contentList, openai.TextContent{
+			Type: model.ContentTypeText,
+			Text: text,
+		})
+	}
+	for _, image := range images {
+		contentList = append(contentList, openai.ImageContent{
+			Type: model.ContentTypeImageURL,
+			ImageURL: &model.ImageURL{
+				Url: imageDataURL(image),
+			},
+		})
+	}
+	return contentList
+}
+
+func applyOptions(textRequest *model.GeneralOpenAIRequest, options *Options) {
+	if options == nil {
+		return
+	}
+	textRequest.Temperature = options.Temperature
+	textRequest.TopP = options.TopP
+	textRequest.TopK = options.TopK
+	textRequest.FrequencyPenalty = options.FrequencyPenalty
+	textRequest.PresencePenalty = options.PresencePenalty
+	textRequest.NumCtx = options.NumCtx
+	if options.Seed != 0 {
+		textRequest.Seed = float64(options.Seed)
+	}
+	// a negative num_predict means no limit
+	if options.NumPredict > 0 {
+		textRequest.MaxTokens = options.NumPredict
+	}
+	if len(options.Stop) > 0 {
+		textRequest.Stop = options.Stop
+	}
+}
+
+// responseFormat converts the format field, which is either "json" or a JSON schema.
+func responseFormat(format any) *model.ResponseFormat {
+	switch format := format.(type) {
+	case string:
+		if format == "json" {
+			return &model.ResponseFormat{Type: "json_object"}
+		}
+	case map[string]any:
+		return &model.ResponseFormat{
+			Type: "json_schema",
+			JsonSchema: &model.JSONSchema{
+				Name:   "response",
+				Schema: format,
+			},
+		}
+	}
+	return nil
+}
+
+func newTextRequest(modelName string, stream bool) *model.GeneralOpenAIRequest {
+	textRequest := model.GeneralOpenAIRequest{
+		Model:  modelName,
+		Stream: stream,
+	}
+	if stream {
+		textRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	return &textRequest
+}
+
+func ConvertInboundChatRequest(request *InboundChatRequest) *model.GeneralOpenAIRequest {
+	textRequest := newTextRequest(request.Model, IsStream(request.Stream))
+	applyOptions(textRequest, request.Options)
+	textRequest.ResponseFormat = responseFormat(request.Format)
+	textRequest.Tools = request.Tools
+	// Ollama has no tool call ids, tool results answer the calls in order
+	var pendingCallIds []string
+	for i, message := range request.Messages {
+		openaiMessage := model.Message{
+			Role:    message.Role,
+			Content: messageContent(message.Content, message.Images),
+		}
+		for j, toolCall := range message.ToolCalls {
+			id := fmt.Sprintf("call_%d_%d", i, j)
+			pendingCallIds = append(pendingCallIds, id)
+			arguments, _ := json.Marshal(toolCall.Function.Arguments)
+			openaiMessage.ToolCalls = append(openaiMessage.ToolCalls, model.Tool{
+				Id:   id,
+				Type: "function",
+				Function: model.Function{
+					Name:      toolCall.Function.Name,
+					Arguments: string(arguments),
+				},
+			})
+		}
+		if message.Role == "tool" && len(pendingCallIds) > 0 {
+			openaiMessage.ToolCallId = pendingCallIds[0]
+			pendingCallIds = pendingCallIds[1:]
+		}
+		textRequest.Messages = append(textRequest.Messages, openaiMessage)
+	}
+	return textRequest
+}
+
+func ConvertInboundGenerateRequest(request *GenerateRequest) *model.GeneralOpenAIRequest {
+	textRequest := newTextRequest(request.Model, IsStream(request.Stream))
+	applyOptions(textRequest, request.Options)
+	textRequest.ResponseFormat = responseFormat(request.Format)
+	if request.System != "" {
+		textRequest.Messages = append(textRequest.Messages, model.Message{
+			Role:    "system",
+			Content: request.System,
+		})
+	}
+	textRequest.Messages = append(textRequest.Messages, model.Message{
+		Role:    "user",
+		Content: messageContent(request.Prompt, request.Images),
+	})
+	return textRequest
+}
+
+func ConvertInboundEmbeddingRequest(request *InboundEmbeddingRequest) *model.GeneralOpenAIRequest {
+	textRequest := newTextRequest(request.Model, false)
+	textRequest.Input = request.Input
+	return textRequest
+}
+
+func doneReasonOpenAI2Ollama(reason string) string {
+	if reason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+func toolCallsOpenAI2Ollama(tools []model.Tool) []ToolCall {
+	var toolCalls []ToolCall
+	for _, tool := range tools {
+		var arguments any
+		if err := json.Unmarshal([]byte(conv.AsString(tool.Function.Arguments)), &arguments); err != nil || arguments == nil {
+			arguments = map[string]any{}
+		}
+		toolCalls = append(toolCalls, ToolCall{
+			Function: ToolCallFunction{
+				Name:      tool.Function.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+	return toolCalls
+}
+
+// InboundConverter turns the chat completions output of the relay pipeline into the responses
+// of /api/chat, or of /api/generate when generate is set. Streams are sent as NDJSON.
+type InboundConverter struct {
+	modelName    string
+	promptTokens int
+	generate     bool
+
+	responseText strings.Builder
+	toolCalls    []model.Tool
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewInboundConverter(modelName string, promptTokens int, generate bool) *InboundConverter {
+	return &InboundConverter{
+		modelName:    modelName,
+		promptTokens: promptTokens,
+		generate:     generate,
+	}
+}
+
+func (c *InboundConverter) ContentType(stream bool) string {
+	if stream {
+		return "application/x-ndjson"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (c *InboundConverter) newResponse(text string, toolCalls []ToolCall) *ChatResponse {
+	return &ChatResponse{
+		Model:     c.modelName,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Message: Message{
+			Role:      "assistant",
+			Content:   text,
+			ToolCalls: toolCalls,
+		},
+	}
+}
+
+// marshal writes /api/generate responses with the text in response instead of message.
+func (c *InboundConverter) marshal(response *ChatResponse) ([]byte, error) {
+	if !c.generate {
+		return json.Marshal(response)
+	}
+	return json.Marshal(GenerateResponse{
+		Model:           response.Model,
+		CreatedAt:       response.CreatedAt,
+		Response:        response.Message.Content,
+		Done:            response.Done,
+		DoneReason:      response.DoneReason,
+		PromptEvalCount: response.PromptEvalCount,
+		EvalCount:       response.EvalCount,
+	})
+}
+
+func (c *InboundConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var openaiResponse openai.TextResponse
+	err := json.Unmarshal(body, &openaiResponse)
+	if err != nil {
+		return nil, err
+	}
+	var response *ChatResponse
+	if len(openaiResponse.Choices) > 0 {
+		choice := openaiResponse.Choices[0]
+		response = c.newResponse(choice.Message.StringContent(), toolCallsOpenAI2Ollama(choice.Message.ToolCalls))
+		response.DoneReason = doneReasonOpenAI2Ollama(choice.FinishReason)
+	} else {
+		response = c.newResponse("", nil)
+		response.DoneReason = "stop"
+	}
+	response.Done = true
+	response.PromptEvalCount = openaiResponse.Usage.PromptTokens
+	response.EvalCount = openaiResponse.Usage.CompletionTokens
+	return c.marshal(response)
+}
+
+func (c *InboundConverter) ConvertError(statusCode int, body []byte) []byte {
+	return errorBodyOpenAI2Ollama(body)
+}
+
+func (c *InboundConverter) writeLine(buf *bytes.Buffer, response *ChatResponse) {
+	jsonData, err := c.marshal(response)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	buf.Write(jsonData)
+	buf.WriteByte('\n')
+}
+
+func (c *InboundConverter) ConvertStreamData(data string) []byte {
+	var streamResponse openai.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	if streamResponse.Usage != nil {
+		c.usage = streamResponse.Usage
+	}
+	var buf bytes.Buffer
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			c.responseText.WriteString(text)
+			c.writeLine(&buf, c.newResponse(text, nil))
+		}
+		// Ollama sends tool calls as a whole, so they are held back until the arguments are complete
+		for _, tool := range choice.Delta.ToolCalls {
+			if tool.Id != "" || len(c.toolCalls) == 0 {
+				c.toolCalls = append(c.toolCalls, model.Tool{
+					Id:       tool.Id,
+					Type:     "function",
+					Function: model.Function{Name: tool.Function.Name},
+				})
+			}
+			last := &c.toolCalls[len(c.toolCalls)-1]
+			last.Function.Arguments = conv.AsString(last.Function.Arguments) + conv.AsString(tool.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *InboundConverter) FinishStream(usage *model.Usage) []byte {
+	var buf bytes.Buffer
+	if usage == nil {
+		usage = c.usage
+	}
+	if usage == nil {
+		usage = openai.ResponseText2Usage(c.responseText.String(), c.modelName, c.promptTokens)
+	}
+	if len(c.toolCalls) > 0 && !c.generate {
+		c.writeLine(&buf, c.newResponse("", toolCallsOpenAI2Ollama(c.toolCalls)))
+	}
+	response := c.newResponse("", nil)
+	response.Done = true
+	response.DoneReason = doneReasonOpenAI2Ollama(c.finishReason)
+	response.PromptEvalCount = usage.PromptTokens
+	response.EvalCount = usage.CompletionTokens
+	c.writeLine(&buf, response)
+	return buf.Bytes()
+}
+
+// EmbeddingConverter turns the embeddings output of the relay pipeline into /api/embed responses.
+type EmbeddingConverter struct {
+	modelName string
+}
+
+func NewEmbeddingConverter(modelName string) *EmbeddingConverter {
+	return &EmbeddingConverter{modelName: modelName}
+}
+
+func (c *EmbeddingConverter) ContentType(stream bool) string {
+	return "application/json; charset=utf-8"
+}
+
+func (c *EmbeddingConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var openaiResponse openai.EmbeddingResponse
+	err := json.Unmarshal(body, &openaiResponse)
+	if err != nil {
+		return nil, err
+	}
+	response := EmbeddingResponse{
+		Model:           c.modelName,
+		Embeddings:      make([][]float64, 0, len(openaiResponse.Data)),
+		PromptEvalCount: openaiResponse.Usage.PromptTokens,
+	}
+	for _, item := range openaiResponse.Data {
+		response.Embeddings = append(response.Embeddings, item.Embedding)
+	}
+	return json.Marshal(response)
+}
+
+func (c *EmbeddingConverter) ConvertStreamData(data string) []byte {
+	return nil
+}
+
+func (c *EmbeddingConverter) FinishStream(usage *model.Usage) []byte {
+	return nil
+}
+
+func (c *EmbeddingConverter) ConvertError(statusCode int, body []byte) []byte {
+	return errorBodyOpenAI2Ollama(body)
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
 	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
@@ -58,12 +59,40 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 	return &ollamaRequest
 }
 
+// generate is the only endpoint that answers in response instead of message
+func responseMessage(response *ChatResponse) Message {
+	if response.Message.Role == "" {
+		return Message{
+			Role:    "assistant",
+			Content: response.Response,
+		}
+	}
+	return response.Message
+}
+
+func ConvertFimRequest(request model.GeneralOpenAIRequest) *GenerateRequest {
+	return &GenerateRequest{
+		Model:  request.Model,
+		Prompt: conv.AsString(request.Prompt),
+		Suffix: request.Suffix,
+		Stream: &request.Stream,
+		Options: &Options{
+			Seed:        int(request.Seed),
+			Temperature: request.Temperature,
+			TopP:        request.TopP,
+			NumPredict:  request.MaxTokens,
+			NumCtx:      request.NumCtx,
+		},
+	}
+}
+
 func responseOllama2OpenAI(response *ChatResponse) *openai.TextResponse {
+	message := responseMessage(response)
 	choice := openai.TextResponseChoice{
 		Index: 0,
 		Message: model.Message{
-			Role:    response.Message.Role,
-			Content: response.Message.Content,
+			Role:    message.Role,
+			Content: message.Content,
 		},
 	}
 	if response.Done {
@@ -86,8 +115,9 @@ func responseOllama2OpenAI(response *ChatResponse) *openai.TextResponse {
 
 func streamResponseOllama2OpenAI(ollamaResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
 	var choice openai.ChatCompletionsStreamResponseChoice
-	choice.Delta.Role = ollamaResponse.Message.Role
-	choice.Delta.Content = ollamaResponse.Message.Content
+	message := responseMessage(ollamaResponse)
+	choice.Delta.Role = message.Role
+	choice.Delta.Content = message.Content
 	if ollamaResponse.Done {
 		choice.FinishReason = &constant.StopFinishReason
 	}
@@ -1,5 +1,7 @@
 package ollama
 
+import "github.com/songquanpeng/one-api/relay/model"
+
 type Options struct {
 	Seed             int      `json:"seed,omitempty"`
 	Temperature      *float64 `json:"temperature,omitempty"`
@@ -9,19 +11,43 @@ type Options struct {
 	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
 	NumPredict       int      `json:"num_predict,omitempty"`
 	NumCtx           int      `json:"num_ctx,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
 }
 
 type Message struct {
-	Role    string   `json:"role,omitempty"`
-	Content string   `json:"content,omitempty"`
-	Images  []string `json:"images,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
 }
 
 type ChatRequest struct {
-	Model    string    `json:"model,omitempty"`
-	Messages []Message `json:"messages,omitempty"`
-	Stream   bool      `json:"stream"`
-	Options  *Options  `json:"options,omitempty"`
+	Model    string       `json:"model,omitempty"`
+	Messages []Message    `json:"messages,omitempty"`
+	Stream   bool         `json:"stream"`
+	Options  *Options     `json:"options,omitempty"`
+	Tools    []model.Tool `json:"tools,omitempty"`
+	Format   any          `json:"format,omitempty"`
+}
+
+type GenerateRequest struct {
+	Model   string   `json:"model"`
+	Prompt  string   `json:"prompt"`
+	Suffix  string   `json:"suffix,omitempty"`
+	System  string   `json:"system,omitempty"`
+	Images  []string `json:"images,omitempty"`
+	Stream  *bool    `json:"stream,omitempty"`
+	Format  any      `json:"format,omitempty"`
+	Options *Options `json:"options,omitempty"`
 }
 
 type ChatResponse struct {
@@ -29,7 +55,8 @@ type ChatResponse struct {
 	CreatedAt       string  `json:"created_at,omitempty"`
 	Message         Message `json:"message,omitempty"`
 	Response        string  `json:"response,omitempty"` // for stream response
-	Done            bool    `json:"done,omitempty"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason,omitempty"`
 	TotalDuration   int     `json:"total_duration,omitempty"`
 	LoadDuration    int     `json:"load_duration,omitempty"`
 	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
@@ -38,6 +65,17 @@ type ChatResponse struct {
 	Error           string  `json:"error,omitempty"`
 }
 
+// GenerateResponse is only used by the inbound API, ChatResponse covers both endpoints of Ollama otherwise.
+type GenerateResponse struct {
+	Model           string `json:"model"`
+	CreatedAt       string `json:"created_at"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason,omitempty"`
+	PromptEvalCount int    `json:"prompt_eval_count,omitempty"`
+	EvalCount       int    `json:"eval_count,omitempty"`
+}
+
 type EmbeddingRequest struct {
 	Model string   `json:"model"`
 	Input []string `json:"input"`
@@ -50,4 +88,27 @@ type EmbeddingResponse struct {
 	Error      string      `json:"error,omitempty"`
 	Model      string      `json:"model"`
 	Embeddings [][]float64 `json:"embeddings"`
+	// PromptEvalCount is only filled in by the inbound API
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+}
+
+type ModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+type ModelInfo struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt string       `json:"modified_at"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+type TagsResponse struct {
+	Models []ModelInfo `json:"models"`
 }
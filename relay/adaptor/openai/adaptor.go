@@ -31,12 +31,17 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Mode == relaymode.Realtime {
+		return GetRealtimeURL(meta), nil
+	}
 	switch meta.ChannelType {
 	case channeltype.Azure:
-		if meta.Mode == relaymode.ImagesGenerations {
+		switch meta.Mode {
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			// https://learn.microsoft.com/en-us/azure/ai-services/openai/dall-e-quickstart?tabs=dalle3%2Ccommand-line&pivots=rest-api
 			// https://{resource_name}.openai.azure.com/openai/deployments/dall-e-3/images/generations?api-version=2024-03-01-preview
-			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
+			task := strings.TrimPrefix(strings.Split(meta.RequestURLPath, "?")[0], "/v1/")
+			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s", meta.BaseURL, meta.ActualModelName, task, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
 
@@ -62,6 +67,12 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		return alibailian.GetRequestURL(meta)
 	case channeltype.GeminiOpenAICompatible:
 		return geminiv2.GetRequestURL(meta)
+	case channeltype.DeepSeek:
+		if meta.Mode == relaymode.FimCompletions {
+			// https://api-docs.deepseek.com/guides/fim_completion
+			return fmt.Sprintf("%s/beta/completions", meta.BaseURL), nil
+		}
+		return GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType), nil
 	default:
 		return GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType), nil
 	}
@@ -102,11 +113,59 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	return request, nil
 }
 
+func (a *Adaptor) ConvertRerankRequest(request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertRerankRequest(request), nil
+}
+
+// ConvertVideoRequest, GetVideoTaskURL and ParseVideoTask serve the OpenAI compatible channels
+// with an asynchronous video API.
+func (a *Adaptor) ConvertVideoRequest(request *model.VideoRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	switch a.ChannelType {
+	case channeltype.Doubao:
+		return doubao.ConvertVideoRequest(*request), nil
+	}
+	return nil, fmt.Errorf("video generation is not supported by channel type %d", a.ChannelType)
+}
+
+func (a *Adaptor) GetVideoTaskURL(meta *meta.Meta, taskId string) (string, error) {
+	switch meta.ChannelType {
+	case channeltype.Doubao:
+		return doubao.GetVideoTaskURL(meta, taskId), nil
+	}
+	return "", fmt.Errorf("video generation is not supported by channel type %d", meta.ChannelType)
+}
+
+func (a *Adaptor) ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	switch a.ChannelType {
+	case channeltype.Doubao:
+		return doubao.ParseVideoTask(resp)
+	}
+	return nil, fmt.Errorf("video generation is not supported by channel type %d", a.ChannelType)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == relaymode.FimCompletions {
+		if !meta.IsStream {
+			err, usage = FimHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+			return
+		}
+		var responseText string
+		err, responseText, usage = FimStreamHandler(c, resp)
+		if usage == nil || usage.TotalTokens == 0 {
+			usage = ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
+		return
+	}
 	if meta.IsStream {
 		var responseText string
 		err, responseText, usage = StreamHandler(c, resp, meta.Mode)
@@ -119,7 +178,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		}
 	} else {
 		switch meta.Mode {
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			err, _ = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
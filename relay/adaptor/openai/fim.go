@@ -0,0 +1,179 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.mistral.ai/api/#tag/fim
+// https://api-docs.deepseek.com/api/create-completion
+// Mistral answers fill-in-the-middle requests in the chat completion format, while DeepSeek
+// uses the legacy text completion one. Clients always get the chat completion format.
+
+type fimChoice struct {
+	Index        int            `json:"index"`
+	Text         *string        `json:"text,omitempty"`
+	Message      *model.Message `json:"message,omitempty"`
+	Delta        *model.Message `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason,omitempty"`
+}
+
+func (choice fimChoice) finishReason() string {
+	if choice.FinishReason == nil {
+		return ""
+	}
+	return *choice.FinishReason
+}
+
+func (choice fimChoice) content() string {
+	switch {
+	case choice.Text != nil:
+		return *choice.Text
+	case choice.Message != nil:
+		return choice.Message.StringContent()
+	case choice.Delta != nil:
+		return conv.AsString(choice.Delta.Content)
+	}
+	return ""
+}
+
+type fimResponse struct {
+	Id      string       `json:"id"`
+	Model   string       `json:"model"`
+	Created int64        `json:"created"`
+	Choices []fimChoice  `json:"choices"`
+	Usage   *model.Usage `json:"usage,omitempty"`
+	Error   model.Error  `json:"error"`
+}
+
+func FimHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var response fimResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if response.Error.Type != "" {
+		return &model.ErrorWithStatusCode{
+			Error:      response.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	textResponse := TextResponse{
+		Id:      response.Id,
+		Model:   response.Model,
+		Object:  "chat.completion",
+		Created: response.Created,
+		Choices: make([]TextResponseChoice, 0, len(response.Choices)),
+	}
+	responseText := ""
+	for _, choice := range response.Choices {
+		content := choice.content()
+		responseText += content
+		textResponse.Choices = append(textResponse.Choices, TextResponseChoice{
+			Index: choice.Index,
+			Message: model.Message{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: choice.finishReason(),
+		})
+	}
+	if response.Usage != nil && response.Usage.TotalTokens != 0 {
+		textResponse.Usage = *response.Usage
+	} else {
+		textResponse.Usage = *ResponseText2Usage(responseText, modelName, promptTokens)
+	}
+	c.JSON(resp.StatusCode, textResponse)
+	return nil, &textResponse.Usage
+}
+
+func FimStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
+	responseText := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(bufio.ScanLines)
+	var usage *model.Usage
+
+	common.SetEventStreamHeaders(c)
+
+	for scanner.Scan() {
+		data := scanner.Text()
+		if !strings.HasPrefix(data, dataPrefix) {
+			continue
+		}
+		data = strings.TrimSpace(data[dataPrefixLength:])
+		if data == done {
+			break
+		}
+		var response fimResponse
+		err := json.Unmarshal([]byte(data), &response)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+		streamResponse := ChatCompletionsStreamResponse{
+			Id:      response.Id,
+			Object:  "chat.completion.chunk",
+			Created: response.Created,
+			Model:   response.Model,
+			Choices: make([]ChatCompletionsStreamResponseChoice, 0, len(response.Choices)),
+			Usage:   response.Usage,
+		}
+		if streamResponse.Created == 0 {
+			streamResponse.Created = helper.GetTimestamp()
+		}
+		for _, choice := range response.Choices {
+			content := choice.content()
+			responseText += content
+			streamResponse.Choices = append(streamResponse.Choices, ChatCompletionsStreamResponseChoice{
+				Index: choice.Index,
+				Delta: model.Message{
+					Content: content,
+				},
+				FinishReason: choice.FinishReason,
+			})
+		}
+		if len(streamResponse.Choices) == 0 && streamResponse.Usage == nil {
+			continue
+		}
+		err = render.ObjectData(c, streamResponse)
+		if err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+
+	render.Done(c)
+
+	err := resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
+	}
+
+	return nil, responseText, usage
+}
@@ -0,0 +1,69 @@
+package openai
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// https://platform.openai.com/docs/api-reference/realtime-server-events
+
+type RealtimeInputTokenDetails struct {
+	CachedTokens        int `json:"cached_tokens"`
+	TextTokens          int `json:"text_tokens"`
+	AudioTokens         int `json:"audio_tokens"`
+	CachedTokensDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		AudioTokens int `json:"audio_tokens"`
+	} `json:"cached_tokens_details"`
+}
+
+type RealtimeOutputTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                        `json:"total_tokens"`
+	InputTokens        int                        `json:"input_tokens"`
+	OutputTokens       int                        `json:"output_tokens"`
+	InputTokenDetails  RealtimeInputTokenDetails  `json:"input_token_details"`
+	OutputTokenDetails RealtimeOutputTokenDetails `json:"output_token_details"`
+}
+
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+type RealtimeError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+type RealtimeEvent struct {
+	EventId  string            `json:"event_id,omitempty"`
+	Type     string            `json:"type"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+	Error    *RealtimeError    `json:"error,omitempty"`
+}
+
+// GetRealtimeURL returns the WebSocket URL of the upstream realtime session.
+func GetRealtimeURL(meta *meta.Meta) string {
+	var fullRequestURL string
+	if meta.ChannelType == channeltype.Azure {
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/realtime-audio-reference
+		fullRequestURL = fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s", meta.BaseURL, meta.Config.APIVersion, url.QueryEscape(meta.ActualModelName))
+	} else {
+		fullRequestURL = GetFullRequestURL(meta.BaseURL, "/v1/realtime?model="+url.QueryEscape(meta.ActualModelName), meta.ChannelType)
+	}
+	if strings.HasPrefix(fullRequestURL, "https://") {
+		return "wss://" + strings.TrimPrefix(fullRequestURL, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(fullRequestURL, "http://")
+}
@@ -0,0 +1,78 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://jina.ai/reranker
+// https://docs.siliconflow.cn/api-reference/rerank/create-rerank
+
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments *bool    `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int      `json:"max_chunks_per_doc,omitempty"`
+}
+
+func ConvertRerankRequest(request *model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.DocumentTexts(),
+		TopN:            request.TopN,
+		ReturnDocuments: request.ReturnDocuments,
+		MaxChunksPerDoc: request.MaxChunksPerDoc,
+	}
+}
+
+// RerankHandler parses a Cohere style rerank response, which is also what Jina and SiliconFlow return.
+// The response is not written here, because the usage is only known once the quota is calculated.
+func RerankHandler(resp *http.Response) (*model.ErrorWithStatusCode, *model.RerankResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if rerankResponse.Results == nil {
+		rerankResponse.Results = []model.RerankResult{}
+	}
+	return nil, &rerankResponse
+}
+
+// RerankUsage returns the input tokens reported by the upstream, or zero when it reports none.
+func RerankUsage(response *model.RerankResponse) int {
+	if response.Usage != nil && response.Usage.TotalTokens != 0 {
+		return response.Usage.TotalTokens
+	}
+	if response.Usage != nil && response.Usage.PromptTokens != 0 {
+		return response.Usage.PromptTokens
+	}
+	if response.Meta != nil && response.Meta.Tokens != nil && response.Meta.Tokens.InputTokens != 0 {
+		return response.Meta.Tokens.InputTokens
+	}
+	if response.Meta != nil && response.Meta.BilledUnits != nil {
+		return response.Meta.BilledUnits.InputTokens
+	}
+	return 0
+}
+
+func RerankSearchUnits(response *model.RerankResponse) int {
+	if response.Meta != nil && response.Meta.BilledUnits != nil {
+		return response.Meta.BilledUnits.SearchUnits
+	}
+	return 0
+}
@@ -0,0 +1,689 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+// The Responses API is served on top of chat completions, so that any channel can answer it.
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort *string `json:"effort,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              any                 `json:"input"`
+	Instructions       string              `json:"instructions,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+	Tools              []ResponsesTool     `json:"tools,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	Text               *ResponsesText      `json:"text,omitempty"`
+	User               string              `json:"user,omitempty"`
+	Metadata           any                 `json:"metadata,omitempty"`
+}
+
+// ShouldStore reports whether the response must be saved, store defaults to true.
+func (r ResponsesRequest) ShouldStore() bool {
+	return r.Store == nil || *r.Store
+}
+
+type ResponsesInputItem struct {
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    any    `json:"output,omitempty"`
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type ResponsesOutputText struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponsesOutputMessage struct {
+	Type    string                `json:"type"`
+	Id      string                `json:"id"`
+	Status  string                `json:"status"`
+	Role    string                `json:"role"`
+	Content []ResponsesOutputText `json:"content"`
+}
+
+type ResponsesFunctionCall struct {
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+	Status    string `json:"status"`
+	CallId    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesResponse struct {
+	Id                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"`
+	Model              string                      `json:"model"`
+	Output             []any                       `json:"output"`
+	Instructions       *string                     `json:"instructions"`
+	PreviousResponseId *string                     `json:"previous_response_id"`
+	Error              *model.Error                `json:"error"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Tools              []ResponsesTool             `json:"tools"`
+	ToolChoice         any                         `json:"tool_choice"`
+	ParallelToolCalls  bool                        `json:"parallel_tool_calls"`
+	Temperature        *float64                    `json:"temperature"`
+	TopP               *float64                    `json:"top_p"`
+	MaxOutputTokens    *int                        `json:"max_output_tokens"`
+	Store              bool                        `json:"store"`
+	Metadata           any                         `json:"metadata"`
+	Usage              *ResponsesUsage             `json:"usage"`
+}
+
+type ResponsesDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type responsesStreamEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	Response       *ResponsesResponse   `json:"response,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	ItemId         string               `json:"item_id,omitempty"`
+	Item           any                  `json:"item,omitempty"`
+	Part           *ResponsesOutputText `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Arguments      *string              `json:"arguments,omitempty"`
+}
+
+func responsesInputItems(input any) []ResponsesInputItem {
+	if text, ok := input.(string); ok {
+		return []ResponsesInputItem{{Type: "message", Role: "user", Content: text}}
+	}
+	var items []ResponsesInputItem
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(data, &items)
+	return items
+}
+
+func responsesMessageContent(content any) any {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	var parts []ResponsesInputContent
+	data, _ := json.Marshal(content)
+	_ = json.Unmarshal(data, &parts)
+	var text strings.Builder
+	var contentList []any
+	hasImage := false
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			text.WriteString(part.Text)
+			contentList = append(contentList, TextContent{Type: model.ContentTypeText, Text: part.Text})
+		case "input_image":
+			if part.ImageURL == "" {
+				continue
+			}
+			hasImage = true
+			contentList = append(contentList, ImageContent{
+				Type:     model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{Url: part.ImageURL, Detail: part.Detail},
+			})
+		}
+	}
+	if hasImage {
+		return contentList
+	}
+	return text.String()
+}
+
+// ConvertResponsesInput converts Responses API input items into chat messages.
+func ConvertResponsesInput(input any) []model.Message {
+	var messages []model.Message
+	for _, item := range responsesInputItems(input) {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			messages = append(messages, model.Message{
+				Role:    role,
+				Content: responsesMessageContent(item.Content),
+			})
+		case "function_call":
+			toolCall := model.Tool{
+				Id:   item.CallId,
+				Type: "function",
+				Function: model.Function{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// consecutive function calls belong to the same assistant turn
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" && len(messages[n-1].ToolCalls) > 0 {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, toolCall)
+				continue
+			}
+			messages = append(messages, model.Message{
+				Role:      "assistant",
+				ToolCalls: []model.Tool{toolCall},
+			})
+		case "function_call_output":
+			output, ok := item.Output.(string)
+			if !ok {
+				output = responsesMessageContentText(item.Output)
+			}
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolCallId: item.CallId,
+			})
+		}
+	}
+	return messages
+}
+
+func responsesMessageContentText(content any) string {
+	text, _ := responsesMessageContent(content).(string)
+	return text
+}
+
+// ConvertResponsesRequest builds the chat completions request of a Responses API call,
+// history holds the messages of the chained previous responses.
+func ConvertResponsesRequest(request *ResponsesRequest, history []model.Message, input []model.Message) *model.GeneralOpenAIRequest {
+	textRequest := model.GeneralOpenAIRequest{
+		Model:            request.Model,
+		MaxTokens:        request.MaxOutputTokens,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		Stream:           request.Stream,
+		ParallelTooCalls: request.ParallelToolCalls,
+		User:             request.User,
+	}
+	if request.Stream {
+		textRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if request.Reasoning != nil {
+		textRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if request.Text != nil && request.Text.Format != nil && request.Text.Format.Type != "text" {
+		textRequest.ResponseFormat = &model.ResponseFormat{Type: request.Text.Format.Type}
+		if request.Text.Format.Type == "json_schema" {
+			textRequest.ResponseFormat.JsonSchema = &model.JSONSchema{
+				Name:        request.Text.Format.Name,
+				Description: request.Text.Format.Description,
+				Schema:      request.Text.Format.Schema,
+				Strict:      request.Text.Format.Strict,
+			}
+		}
+	}
+	if request.Instructions != "" {
+		textRequest.Messages = append(textRequest.Messages, model.Message{
+			Role:    "system",
+			Content: request.Instructions,
+		})
+	}
+	textRequest.Messages = append(textRequest.Messages, history...)
+	textRequest.Messages = append(textRequest.Messages, input...)
+	for _, tool := range request.Tools {
+		// built-in tools such as web_search only exist on OpenAI's side
+		if tool.Type != "function" {
+			continue
+		}
+		textRequest.Tools = append(textRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	switch toolChoice := request.ToolChoice.(type) {
+	case string:
+		textRequest.ToolChoice = toolChoice
+	case map[string]any:
+		if name, ok := toolChoice["name"].(string); ok {
+			textRequest.ToolChoice = map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": name,
+				},
+			}
+		}
+	}
+	return &textRequest
+}
+
+// ResponsesConverter turns the chat completions output of the relay pipeline into Responses API output.
+type ResponsesConverter struct {
+	request      *ResponsesRequest
+	response     ResponsesResponse
+	promptTokens int
+	completed    bool
+
+	sequenceNumber int
+	started        bool
+	itemType       string
+	itemId         string
+	callId         string
+	toolName       string
+	text           strings.Builder
+	arguments      strings.Builder
+	finishReason   string
+	usage          *model.Usage
+	message        model.Message
+}
+
+func NewResponsesConverter(request *ResponsesRequest, promptTokens int) *ResponsesConverter {
+	converter := &ResponsesConverter{
+		request:      request,
+		promptTokens: promptTokens,
+		message:      model.Message{Role: "assistant"},
+	}
+	converter.response = ResponsesResponse{
+		Id:                "resp_" + random.GetUUID(),
+		Object:            "response",
+		CreatedAt:         helper.GetTimestamp(),
+		Status:            "in_progress",
+		Model:             request.Model,
+		Output:            []any{},
+		Tools:             request.Tools,
+		ToolChoice:        request.ToolChoice,
+		ParallelToolCalls: request.ParallelToolCalls == nil || *request.ParallelToolCalls,
+		Temperature:       request.Temperature,
+		TopP:              request.TopP,
+		Store:             request.ShouldStore(),
+		Metadata:          request.Metadata,
+	}
+	if converter.response.Tools == nil {
+		converter.response.Tools = []ResponsesTool{}
+	}
+	if converter.response.ToolChoice == nil {
+		converter.response.ToolChoice = "auto"
+	}
+	if request.Instructions != "" {
+		converter.response.Instructions = &request.Instructions
+	}
+	if request.PreviousResponseId != "" {
+		converter.response.PreviousResponseId = &request.PreviousResponseId
+	}
+	if request.MaxOutputTokens != 0 {
+		converter.response.MaxOutputTokens = &request.MaxOutputTokens
+	}
+	return converter
+}
+
+// Result returns the final response, or nil if the request did not complete.
+func (c *ResponsesConverter) Result() *ResponsesResponse {
+	if !c.completed || c.response.Status == "failed" {
+		return nil
+	}
+	return &c.response
+}
+
+// OutputMessage returns the generated assistant turn, to be stored as chat history.
+func (c *ResponsesConverter) OutputMessage() model.Message {
+	return c.message
+}
+
+func (c *ResponsesConverter) ContentType(stream bool) string {
+	if stream {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (c *ResponsesConverter) ConvertError(statusCode int, body []byte) []byte {
+	return body
+}
+
+func (c *ResponsesConverter) complete(usage *model.Usage) {
+	if usage == nil {
+		usage = ResponseText2Usage(c.text.String()+c.arguments.String(), c.request.Model, c.promptTokens)
+	}
+	c.response.Usage = &ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+	}
+	c.response.Usage.InputTokensDetails.CachedTokens = usage.GetCachedTokens()
+	if usage.CompletionTokensDetails != nil {
+		c.response.Usage.OutputTokensDetails.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	c.response.Status = "completed"
+	switch c.finishReason {
+	case "length":
+		c.response.Status = "incomplete"
+		c.response.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		c.response.Status = "incomplete"
+		c.response.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "content_filter"}
+	}
+	c.completed = true
+}
+
+func (c *ResponsesConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var textResponse TextResponse
+	err := json.Unmarshal(body, &textResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(textResponse.Choices) > 0 {
+		choice := textResponse.Choices[0]
+		c.finishReason = choice.FinishReason
+		if text := choice.Message.StringContent(); text != "" {
+			c.text.WriteString(text)
+			c.message.Content = text
+			c.response.Output = append(c.response.Output, ResponsesOutputMessage{
+				Type:    "message",
+				Id:      "msg_" + random.GetUUID(),
+				Status:  "completed",
+				Role:    "assistant",
+				Content: []ResponsesOutputText{{Type: "output_text", Text: text, Annotations: []any{}}},
+			})
+		}
+		for _, tool := range choice.Message.ToolCalls {
+			arguments := conv.AsString(tool.Function.Arguments)
+			c.arguments.WriteString(arguments)
+			c.message.ToolCalls = append(c.message.ToolCalls, tool)
+			c.response.Output = append(c.response.Output, ResponsesFunctionCall{
+				Type:      "function_call",
+				Id:        "fc_" + random.GetUUID(),
+				Status:    "completed",
+				CallId:    tool.Id,
+				Name:      tool.Function.Name,
+				Arguments: arguments,
+			})
+		}
+	}
+	if textResponse.Model != "" {
+		c.response.Model = textResponse.Model
+	}
+	c.complete(&textResponse.Usage)
+	return json.Marshal(c.response)
+}
+
+func (c *ResponsesConverter) writeEvent(buf *bytes.Buffer, event responsesStreamEvent) {
+	event.SequenceNumber = c.sequenceNumber
+	c.sequenceNumber++
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		logger.SysError("error marshalling stream event: " + err.Error())
+		return
+	}
+	fmt.Fprintf(buf, "event: %s\ndata: %s\n\n", event.Type, jsonData)
+}
+
+func (c *ResponsesConverter) start(buf *bytes.Buffer) {
+	if c.started {
+		return
+	}
+	c.started = true
+	response := c.response
+	c.writeEvent(buf, responsesStreamEvent{Type: "response.created", Response: &response})
+	c.writeEvent(buf, responsesStreamEvent{Type: "response.in_progress", Response: &response})
+}
+
+func (c *ResponsesConverter) outputIndex() *int {
+	index := len(c.response.Output)
+	return &index
+}
+
+func (c *ResponsesConverter) startItem(buf *bytes.Buffer, itemType string, callId string, name string) {
+	if c.itemType == itemType && (itemType != "function_call" || callId == "" || callId == c.callId) {
+		return
+	}
+	c.stopItem(buf)
+	c.itemType = itemType
+	zero := 0
+	switch itemType {
+	case "message":
+		c.itemId = "msg_" + random.GetUUID()
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:        "response.output_item.added",
+			OutputIndex: c.outputIndex(),
+			Item: ResponsesOutputMessage{
+				Type:    "message",
+				Id:      c.itemId,
+				Status:  "in_progress",
+				Role:    "assistant",
+				Content: []ResponsesOutputText{},
+			},
+		})
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:         "response.content_part.added",
+			OutputIndex:  c.outputIndex(),
+			ContentIndex: &zero,
+			ItemId:       c.itemId,
+			Part:         &ResponsesOutputText{Type: "output_text", Annotations: []any{}},
+		})
+	case "function_call":
+		c.itemId = "fc_" + random.GetUUID()
+		c.callId = callId
+		c.toolName = name
+		c.arguments.Reset()
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:        "response.output_item.added",
+			OutputIndex: c.outputIndex(),
+			Item: ResponsesFunctionCall{
+				Type:   "function_call",
+				Id:     c.itemId,
+				Status: "in_progress",
+				CallId: callId,
+				Name:   name,
+			},
+		})
+	}
+}
+
+func (c *ResponsesConverter) stopItem(buf *bytes.Buffer) {
+	zero := 0
+	switch c.itemType {
+	case "message":
+		text := c.text.String()
+		part := ResponsesOutputText{Type: "output_text", Text: text, Annotations: []any{}}
+		item := ResponsesOutputMessage{
+			Type:    "message",
+			Id:      c.itemId,
+			Status:  "completed",
+			Role:    "assistant",
+			Content: []ResponsesOutputText{part},
+		}
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:         "response.output_text.done",
+			OutputIndex:  c.outputIndex(),
+			ContentIndex: &zero,
+			ItemId:       c.itemId,
+			Text:         &text,
+		})
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:         "response.content_part.done",
+			OutputIndex:  c.outputIndex(),
+			ContentIndex: &zero,
+			ItemId:       c.itemId,
+			Part:         &part,
+		})
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:        "response.output_item.done",
+			OutputIndex: c.outputIndex(),
+			Item:        item,
+		})
+		c.message.Content = text
+		c.response.Output = append(c.response.Output, item)
+	case "function_call":
+		arguments := c.arguments.String()
+		item := ResponsesFunctionCall{
+			Type:      "function_call",
+			Id:        c.itemId,
+			Status:    "completed",
+			CallId:    c.callId,
+			Name:      c.toolName,
+			Arguments: arguments,
+		}
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:        "response.function_call_arguments.done",
+			OutputIndex: c.outputIndex(),
+			ItemId:      c.itemId,
+			Arguments:   &arguments,
+		})
+		c.writeEvent(buf, responsesStreamEvent{
+			Type:        "response.output_item.done",
+			OutputIndex: c.outputIndex(),
+			Item:        item,
+		})
+		c.message.ToolCalls = append(c.message.ToolCalls, model.Tool{
+			Id:   c.callId,
+			Type: "function",
+			Function: model.Function{
+				Name:      c.toolName,
+				Arguments: arguments,
+			},
+		})
+		c.response.Output = append(c.response.Output, item)
+	}
+	c.itemType = ""
+	c.callId = ""
+}
+
+func (c *ResponsesConverter) ConvertStreamData(data string) []byte {
+	var streamResponse ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	var buf bytes.Buffer
+	if streamResponse.Model != "" {
+		c.response.Model = streamResponse.Model
+	}
+	c.start(&buf)
+	if streamResponse.Usage != nil {
+		c.usage = streamResponse.Usage
+	}
+	zero := 0
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			c.startItem(&buf, "message", "", "")
+			c.text.WriteString(text)
+			c.writeEvent(&buf, responsesStreamEvent{
+				Type:         "response.output_text.delta",
+				OutputIndex:  c.outputIndex(),
+				ContentIndex: &zero,
+				ItemId:       c.itemId,
+				Delta:        text,
+			})
+		}
+		for _, tool := range choice.Delta.ToolCalls {
+			if tool.Id != "" || c.itemType != "function_call" {
+				c.startItem(&buf, "function_call", tool.Id, tool.Function.Name)
+			}
+			if arguments := conv.AsString(tool.Function.Arguments); arguments != "" {
+				c.arguments.WriteString(arguments)
+				c.writeEvent(&buf, responsesStreamEvent{
+					Type:        "response.function_call_arguments.delta",
+					OutputIndex: c.outputIndex(),
+					ItemId:      c.itemId,
+					Delta:       arguments,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *ResponsesConverter) FinishStream(usage *model.Usage) []byte {
+	var buf bytes.Buffer
+	c.start(&buf)
+	c.stopItem(&buf)
+	if usage == nil {
+		usage = c.usage
+	}
+	c.complete(usage)
+	if c.finishReason == "" {
+		// the upstream closed the stream without finishing the choice, e.g. it was cut off
+		c.response.Status = "failed"
+		c.response.IncompleteDetails = nil
+		c.response.Error = &model.Error{
+			Message: "upstream stream ended before the response finished",
+			Type:    "server_error",
+			Code:    "stream_interrupted",
+		}
+	}
+	c.writeEvent(&buf, responsesStreamEvent{Type: "response." + c.response.Status, Response: &c.response})
+	return buf.Bytes()
+}
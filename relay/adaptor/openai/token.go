@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -100,7 +101,12 @@ func CountTokenMessages(messages []model.Message, model string) int {
 			tokenNum += getTokenNum(tokenEncoder, v)
 		case []any:
 			for _, it := range v {
-				m := it.(map[string]any)
+				m, ok := it.(map[string]any)
+				if !ok {
+					// typed parts, e.g. built by the inbound converters instead of decoded from JSON
+					jsonData, _ := json.Marshal(it)
+					_ = json.Unmarshal(jsonData, &m)
+				}
 				switch m["type"] {
 				case "text":
 					if textValue, ok := m["text"]; ok {
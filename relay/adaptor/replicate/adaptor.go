@@ -96,6 +96,9 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Mode == relaymode.Videos {
+		return GetVideoRequestURL(meta), nil
+	}
 	if !slices.Contains(ModelList, meta.OriginModelName) {
 		return "", errors.Errorf("model %s not supported", meta.OriginModelName)
 	}
@@ -109,6 +112,18 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	return nil
 }
 
+func (a *Adaptor) ConvertVideoRequest(request *model.VideoRequest) (any, error) {
+	return ConvertVideoRequest(*request), nil
+}
+
+func (a *Adaptor) GetVideoTaskURL(meta *meta.Meta, taskId string) (string, error) {
+	return GetVideoTaskURL(meta, taskId), nil
+}
+
+func (a *Adaptor) ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	return ParseVideoTask(resp)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	logger.Info(c, "send request to replicate")
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
@@ -54,5 +54,6 @@ var ModelList = []string{
 	// -------------------------------------
 	// video model
 	// -------------------------------------
-	// "minimax/video-01",  // TODO: implement the adaptor
+	"minimax/video-01",
+	"kwaivgi/kling-v1.6-standard",
 }
@@ -0,0 +1,100 @@
+package replicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://replicate.com/collections/text-to-video
+
+// VideoInput carries the first frame under the names used by both kling and minimax models.
+type VideoInput struct {
+	Prompt          string `json:"prompt"`
+	Duration        int    `json:"duration,omitempty"`
+	StartImage      string `json:"start_image,omitempty"`
+	FirstFrameImage string `json:"first_frame_image,omitempty"`
+}
+
+type VideoRequest struct {
+	Input VideoInput `json:"input"`
+}
+
+type VideoResponse struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	// Output could be `string` or `[]string`
+	Output any `json:"output"`
+	Error  any `json:"error"`
+}
+
+func ConvertVideoRequest(request model.VideoRequest) *VideoRequest {
+	return &VideoRequest{
+		Input: VideoInput{
+			Prompt:          request.Prompt,
+			Duration:        request.GetSeconds(),
+			StartImage:      request.ImageURL,
+			FirstFrameImage: request.ImageURL,
+		},
+	}
+}
+
+// getAPIBase strips the models path of the channel base url.
+func getAPIBase(meta *meta.Meta) string {
+	return strings.TrimSuffix(strings.TrimSuffix(meta.BaseURL, "/"), "/v1/models")
+}
+
+func GetVideoRequestURL(meta *meta.Meta) string {
+	return fmt.Sprintf("%s/v1/models/%s/predictions", getAPIBase(meta), meta.ActualModelName)
+}
+
+func GetVideoTaskURL(meta *meta.Meta, taskId string) string {
+	return fmt.Sprintf("%s/v1/predictions/%s", getAPIBase(meta), taskId)
+}
+
+func ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	var response VideoResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	task := &model.VideoTask{
+		Id: response.Id,
+	}
+	switch response.Status {
+	case "starting":
+		task.Status = model.VideoStatusQueued
+	case "processing":
+		task.Status = model.VideoStatusInProgress
+	case "succeeded":
+		task.Status = model.VideoStatusCompleted
+		switch output := response.Output.(type) {
+		case string:
+			task.VideoURL = output
+		case []any:
+			if len(output) > 0 {
+				task.VideoURL = conv.AsString(output[0])
+			}
+		}
+	case "failed", "canceled":
+		task.Status = model.VideoStatusFailed
+		task.Error = response.Status
+		if response.Error != nil {
+			task.Error = fmt.Sprintf("%v", response.Error)
+		}
+	default:
+		task.Status = model.VideoStatusQueued
+	}
+	return task, nil
+}
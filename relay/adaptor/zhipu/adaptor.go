@@ -37,6 +37,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		return fmt.Sprintf("%s/api/paas/v4/images/generations", meta.BaseURL), nil
 	case relaymode.Embeddings:
 		return fmt.Sprintf("%s/api/paas/v4/embeddings", meta.BaseURL), nil
+	case relaymode.Videos:
+		return fmt.Sprintf("%s/api/paas/v4/videos/generations", meta.BaseURL), nil
 	}
 	a.SetVersionByModeName(meta.ActualModelName)
 	if a.APIVersion == "v4" {
@@ -92,6 +94,21 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	return newRequest, nil
 }
 
+func (a *Adaptor) ConvertVideoRequest(request *model.VideoRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertVideoRequest(*request), nil
+}
+
+func (a *Adaptor) GetVideoTaskURL(meta *meta.Meta, taskId string) (string, error) {
+	return GetVideoTaskURL(meta, taskId), nil
+}
+
+func (a *Adaptor) ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	return ParseVideoTask(resp)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
@@ -9,6 +9,7 @@ var ModelList = []string{
 	"glm-4v-plus", "glm-4v", "glm-4v-flash",
 	"cogview-3-plus", "cogview-3", "cogview-3-flash",
 	"cogviewx", "cogviewx-flash",
+	"cogvideox", "cogvideox-flash",
 	"charglm-4", "emohaa", "codegeex-4",
 	"embedding-2", "embedding-3",
 }
@@ -0,0 +1,83 @@
+package zhipu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://open.bigmodel.cn/dev/api/videomodel/cogvideox
+
+type VideoRequest struct {
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+type VideoResult struct {
+	Url           string `json:"url"`
+	CoverImageUrl string `json:"cover_image_url"`
+}
+
+type VideoTaskResponse struct {
+	Id          string        `json:"id"`
+	RequestId   string        `json:"request_id"`
+	TaskStatus  string        `json:"task_status"`
+	VideoResult []VideoResult `json:"video_result"`
+	Error       *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func ConvertVideoRequest(request model.VideoRequest) *VideoRequest {
+	return &VideoRequest{
+		Model:    request.Model,
+		Prompt:   request.Prompt,
+		ImageURL: request.ImageURL,
+		Size:     request.Size,
+		Duration: request.GetSeconds(),
+	}
+}
+
+func GetVideoTaskURL(meta *meta.Meta, taskId string) string {
+	return fmt.Sprintf("%s/api/paas/v4/async-result/%s", meta.BaseURL, taskId)
+}
+
+func ParseVideoTask(resp *http.Response) (*model.VideoTask, error) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	var response VideoTaskResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return nil, fmt.Errorf("%s: %s", response.Error.Code, response.Error.Message)
+	}
+	task := &model.VideoTask{
+		Id: response.Id,
+	}
+	switch response.TaskStatus {
+	case "SUCCESS":
+		task.Status = model.VideoStatusCompleted
+		if len(response.VideoResult) > 0 {
+			task.VideoURL = response.VideoResult[0].Url
+		}
+	case "FAIL":
+		task.Status = model.VideoStatusFailed
+		task.Error = "video generation failed"
+	default:
+		task.Status = model.VideoStatusInProgress
+	}
+	return task, nil
+}
@@ -0,0 +1,109 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// The prompt tokens read from or written to the prompt cache of an upstream are billed at these
+// ratios of the price of a prompt token. The names are matched like those of CompletionRatio, the
+// models not listed fall back to the discount of their vendor.
+
+var cacheRatioLock sync.RWMutex
+
+var CacheReadRatio = map[string]float64{}
+
+var CacheWriteRatio = map[string]float64{}
+
+func CacheReadRatio2JSONString() string {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(CacheReadRatio)
+	if err != nil {
+		logger.SysError("error marshalling cache read ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCacheReadRatioByJSONString(jsonStr string) error {
+	ratio := make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ratio)
+	if err != nil {
+		return err
+	}
+	cacheRatioLock.Lock()
+	defer cacheRatioLock.Unlock()
+	CacheReadRatio = ratio
+	return nil
+}
+
+func CacheWriteRatio2JSONString() string {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(CacheWriteRatio)
+	if err != nil {
+		logger.SysError("error marshalling cache write ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCacheWriteRatioByJSONString(jsonStr string) error {
+	ratio := make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ratio)
+	if err != nil {
+		return err
+	}
+	cacheRatioLock.Lock()
+	defer cacheRatioLock.Unlock()
+	CacheWriteRatio = ratio
+	return nil
+}
+
+func lookupCacheRatio(ratios map[string]float64, name string, channelType int) (float64, bool) {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	if ratio, ok := ratios[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return ratio, true
+	}
+	ratio, ok := ratios[name]
+	return ratio, ok
+}
+
+// GetCacheReadRatio returns the ratio a prompt token read from the cache is billed at.
+func GetCacheReadRatio(name string, channelType int) float64 {
+	if ratio, ok := lookupCacheRatio(CacheReadRatio, name, channelType); ok {
+		return ratio
+	}
+	switch {
+	// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching#pricing
+	case strings.HasPrefix(name, "claude-"), strings.Contains(name, "anthropic.claude"):
+		return 0.1
+	// https://api-docs.deepseek.com/quick_start/pricing
+	case strings.HasPrefix(name, "deepseek-"):
+		return 0.1
+	// https://ai.google.dev/gemini-api/docs/caching
+	case strings.HasPrefix(name, "gemini-"):
+		return 0.25
+	// https://openai.com/api/pricing
+	case strings.HasPrefix(name, "gpt-4.1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return 0.25
+	case strings.HasPrefix(name, "gpt-4o"), strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "chatgpt-"):
+		return 0.5
+	}
+	return 1
+}
+
+// GetCacheWriteRatio returns the ratio a prompt token written to the cache is billed at.
+func GetCacheWriteRatio(name string, channelType int) float64 {
+	if ratio, ok := lookupCacheRatio(CacheWriteRatio, name, channelType); ok {
+		return ratio
+	}
+	if strings.HasPrefix(name, "claude-") || strings.Contains(name, "anthropic.claude") {
+		return 1.25
+	}
+	return 1
+}
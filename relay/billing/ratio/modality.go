@@ -0,0 +1,103 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// The tokens of some kinds cost more or less than text tokens. Their ratios are relative to the
+// price of a text token of the same side, the prompt for the input kinds and the completion for
+// the output kinds. A model matches the longest name it starts with, e.g. the dated snapshots of a
+// model share its ratios.
+
+const (
+	ModalityReasoning   = "reasoning"
+	ModalityAudioInput  = "audio_input"
+	ModalityAudioOutput = "audio_output"
+	ModalityImageOutput = "image_output"
+)
+
+var modalityRatioLock sync.RWMutex
+
+var ModalityRatio = map[string]map[string]float64{
+	// https://platform.openai.com/docs/pricing
+	"gpt-4o-audio-preview":         {ModalityAudioInput: 40 / 2.5, ModalityAudioOutput: 80 / 10},
+	"gpt-4o-mini-audio-preview":    {ModalityAudioInput: 10 / 0.15, ModalityAudioOutput: 20 / 0.6},
+	"gpt-4o-realtime-preview":      {ModalityAudioInput: 40 / 5, ModalityAudioOutput: 80 / 20},
+	"gpt-4o-mini-realtime-preview": {ModalityAudioInput: 10 / 0.6, ModalityAudioOutput: 20 / 2.4},
+	// https://ai.google.dev/gemini-api/docs/pricing
+	"gemini-2.0-flash":                          {ModalityAudioInput: 0.7 / 0.1},
+	"gemini-2.0-flash-lite":                     {ModalityAudioInput: 1},
+	"gemini-2.5-flash":                          {ModalityAudioInput: 1 / 0.3},
+	"gemini-2.5-flash-lite":                     {ModalityAudioInput: 0.3 / 0.1},
+	"gemini-2.0-flash-preview-image-generation": {ModalityAudioInput: 0.7 / 0.1, ModalityImageOutput: 30 / 0.4},
+	"gemini-2.5-flash-image":                    {ModalityAudioInput: 1 / 0.3, ModalityImageOutput: 30 / 2.5},
+}
+
+var DefaultModalityRatio map[string]map[string]float64
+
+func init() {
+	DefaultModalityRatio = make(map[string]map[string]float64)
+	for k, v := range ModalityRatio {
+		DefaultModalityRatio[k] = v
+	}
+}
+
+func ModalityRatio2JSONString() string {
+	modalityRatioLock.RLock()
+	defer modalityRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModalityRatio)
+	if err != nil {
+		logger.SysError("error marshalling modality ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModalityRatioByJSONString(jsonStr string) error {
+	ratio := make(map[string]map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ratio)
+	if err != nil {
+		return err
+	}
+	modalityRatioLock.Lock()
+	defer modalityRatioLock.Unlock()
+	ModalityRatio = ratio
+	return nil
+}
+
+func lookupModalityRatio(ratios map[string]map[string]float64, name string, modality string) (float64, bool) {
+	if ratio, ok := ratios[name][modality]; ok {
+		return ratio, true
+	}
+	longest := ""
+	for prefix, modalities := range ratios {
+		if _, ok := modalities[modality]; ok && len(prefix) > len(longest) && strings.HasPrefix(name, prefix) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return 0, false
+	}
+	return ratios[longest][modality], true
+}
+
+// GetModalityRatio returns the ratio a token of the kind is billed at, 1 if the model has none.
+func GetModalityRatio(name string, channelType int, modality string) float64 {
+	modalityRatioLock.RLock()
+	defer modalityRatioLock.RUnlock()
+	model := fmt.Sprintf("%s(%d)", name, channelType)
+	if ratio, ok := ModalityRatio[model][modality]; ok {
+		return ratio
+	}
+	if ratio, ok := lookupModalityRatio(ModalityRatio, name, modality); ok {
+		return ratio
+	}
+	if ratio, ok := lookupModalityRatio(DefaultModalityRatio, name, modality); ok {
+		return ratio
+	}
+	return 1
+}
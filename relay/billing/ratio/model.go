@@ -160,6 +160,9 @@ var ModelRatio = map[string]float64{
 	"codegeex-4":       0.0001 * RMB,
 	"embedding-2":      0.0005 * RMB,
 	"embedding-3":      0.0005 * RMB,
+	// zhipu video models are priced per second of the generated video
+	"cogvideox":       0.1 * RMB,
+	"cogvideox-flash": 0,
 	// https://help.aliyun.com/zh/dashscope/developer-reference/tongyi-thousand-questions-metering-and-billing
 	"qwen-turbo":                    0.0003 * RMB,
 	"qwen-turbo-latest":             0.0003 * RMB,
@@ -240,6 +243,10 @@ var ModelRatio = map[string]float64{
 	"ali-stable-diffusion-xl":       8.00,
 	"ali-stable-diffusion-v1.5":     8.00,
 	"wanx-v1":                       8.00,
+	"wanx2.1-t2v-turbo":             0.24 * RMB,
+	"wanx2.1-t2v-plus":              0.70 * RMB,
+	"wanx2.1-i2v-turbo":             0.24 * RMB,
+	"wanx2.1-i2v-plus":              0.70 * RMB,
 	"deepseek-r1":                   0.002 * RMB,
 	"deepseek-v3":                   0.001 * RMB,
 	"deepseek-r1-distill-qwen-1.5b": 0.001 * RMB,
@@ -294,6 +301,7 @@ var ModelRatio = map[string]float64{
 	"mistral-medium-latest": 2.7 / 1000 * USD,
 	"mistral-large-latest":  8.0 / 1000 * USD,
 	"mistral-embed":         0.1 / 1000 * USD,
+	"codestral-latest":      0.3 / 1000 * USD,
 	// https://wow.groq.com/#:~:text=inquiries%C2%A0here.-,Model,-Current%20Speed
 	"gemma-7b-it":                           0.07 / 1000000 * USD,
 	"gemma2-9b-it":                          0.20 / 1000000 * USD,
@@ -334,6 +342,15 @@ var ModelRatio = map[string]float64{
 	"command-light-nightly": 0.5,
 	"command-r":             0.5 / 1000 * USD,
 	"command-r-plus":        3.0 / 1000 * USD,
+	// rerank models are billed by search units, one search unit is counted as 1K tokens
+	"rerank-v3.5":              2.0 / 1000 * USD,
+	"rerank-english-v3.0":      2.0 / 1000 * USD,
+	"rerank-multilingual-v3.0": 2.0 / 1000 * USD,
+	// https://www.volcengine.com/docs/82379/1544106
+	// doubao video models are priced per second of the generated video
+	"doubao-seedance-1-0-pro-250528":      0.73 * RMB,
+	"doubao-seedance-1-0-lite-t2v-250428": 0.28 * RMB,
+	"doubao-seedance-1-0-lite-i2v-250428": 0.28 * RMB,
 	// https://platform.deepseek.com/api-docs/pricing/
 	"deepseek-chat":     0.14 * MILLI_USD,
 	"deepseek-reasoner": 0.55 * MILLI_USD,
@@ -368,6 +385,9 @@ var ModelRatio = map[string]float64{
 	"stability-ai/stable-diffusion-3.5-large":       0.065 * USD,
 	"stability-ai/stable-diffusion-3.5-large-turbo": 0.04 * USD,
 	"stability-ai/stable-diffusion-3.5-medium":      0.035 * USD,
+	// replicate video models are priced per second of the generated video
+	"minimax/video-01":            0.08 * USD,
+	"kwaivgi/kling-v1.6-standard": 0.056 * USD,
 	// replicate chat models
 	"ibm-granite/granite-20b-code-instruct-8k":  0.100 * USD,
 	"ibm-granite/granite-3.0-2b-instruct":       0.030 * USD,
@@ -776,7 +796,7 @@ func GetCompletionRatio(name string, channelType int) float64 {
 	if strings.HasPrefix(name, "claude-") {
 		return 3
 	}
-	if strings.HasPrefix(name, "mistral-") {
+	if strings.HasPrefix(name, "mistral-") || strings.HasPrefix(name, "codestral-") {
 		return 3
 	}
 	if strings.HasPrefix(name, "gemini-") {
@@ -0,0 +1,49 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelPrice is the fixed price in USD of the models billed per call rather than by tokens, e.g.
+// {"gpt-4o-search-preview": 0.03}. The price is per request, per image for the image models and
+// per second of video for the video models, multiplied by the group ratio. A model with a price
+// ignores its ModelRatio.
+var ModelPrice = map[string]float64{}
+var modelPriceLock sync.RWMutex
+
+func ModelPrice2JSONString() string {
+	modelPriceLock.RLock()
+	defer modelPriceLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelPrice)
+	if err != nil {
+		logger.SysError("error marshalling model price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelPriceByJSONString(jsonStr string) error {
+	price := make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &price)
+	if err != nil {
+		return err
+	}
+	modelPriceLock.Lock()
+	defer modelPriceLock.Unlock()
+	ModelPrice = price
+	return nil
+}
+
+// GetModelPrice returns the fixed price of the model, false if it is billed by tokens.
+func GetModelPrice(name string, channelType int) (float64, bool) {
+	modelPriceLock.RLock()
+	defer modelPriceLock.RUnlock()
+	if price, ok := ModelPrice[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return price, true
+	}
+	price, ok := ModelPrice[name]
+	return price, ok
+}
@@ -0,0 +1,81 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PriceTier is the price of a model for the requests whose prompt has more tokens than the
+// threshold, long prompts cost more on some models. It replaces the model ratio, and the
+// completion ratio if it has one.
+type PriceTier struct {
+	Threshold       int     `json:"threshold"`
+	ModelRatio      float64 `json:"model_ratio"`
+	CompletionRatio float64 `json:"completion_ratio,omitempty"`
+}
+
+var modelRatioTiersLock sync.RWMutex
+
+// ModelRatioTiers lists the tiers of the models priced by the length of the prompt. A model matches
+// the longest name it starts with, e.g. the dated snapshots of a model share its tiers.
+var ModelRatioTiers = map[string][]PriceTier{
+	// https://ai.google.dev/gemini-api/docs/pricing
+	"gemini-1.5-pro": {{Threshold: 128000, ModelRatio: 2.5 * MILLI_USD, CompletionRatio: 10 / 2.5}},
+	"gemini-2.5-pro": {{Threshold: 200000, ModelRatio: 2.5 * MILLI_USD, CompletionRatio: 15 / 2.5}},
+	// https://docs.anthropic.com/en/docs/build-with-claude/context-windows#1m-token-context-window
+	"claude-sonnet-4": {{Threshold: 200000, ModelRatio: 6 * MILLI_USD, CompletionRatio: 22.5 / 6}},
+}
+
+func ModelRatioTiers2JSONString() string {
+	modelRatioTiersLock.RLock()
+	defer modelRatioTiersLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelRatioTiers)
+	if err != nil {
+		logger.SysError("error marshalling model ratio tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelRatioTiersByJSONString(jsonStr string) error {
+	tiers := make(map[string][]PriceTier)
+	err := json.Unmarshal([]byte(jsonStr), &tiers)
+	if err != nil {
+		return err
+	}
+	modelRatioTiersLock.Lock()
+	defer modelRatioTiersLock.Unlock()
+	ModelRatioTiers = tiers
+	return nil
+}
+
+// GetModelRatioTier returns the tier of the highest threshold the prompt is above, nil if the prompt
+// is priced at the model ratio.
+func GetModelRatioTier(name string, channelType int, promptTokens int) *PriceTier {
+	modelRatioTiersLock.RLock()
+	defer modelRatioTiersLock.RUnlock()
+	tiers, ok := ModelRatioTiers[fmt.Sprintf("%s(%d)", name, channelType)]
+	if !ok {
+		longest := ""
+		for prefix := range ModelRatioTiers {
+			if len(prefix) > len(longest) && strings.HasPrefix(name, prefix) {
+				longest = prefix
+			}
+		}
+		tiers = ModelRatioTiers[longest]
+	}
+	var chosen *PriceTier
+	for i := range tiers {
+		if promptTokens > tiers[i].Threshold && (chosen == nil || tiers[i].Threshold > chosen.Threshold) {
+			chosen = &tiers[i]
+		}
+	}
+	if chosen == nil {
+		return nil
+	}
+	tier := *chosen
+	return &tier
+}
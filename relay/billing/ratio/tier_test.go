@@ -0,0 +1,29 @@
+package ratio
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetModelRatioTier(t *testing.T) {
+	Convey("GetModelRatioTier", t, func() {
+		defaultTiers := ModelRatioTiers2JSONString()
+		So(UpdateModelRatioTiersByJSONString(`{"gemini-2.5-pro": [{"threshold": 200000, "model_ratio": 1.25}, {"threshold": 1000, "model_ratio": 0.8}]}`), ShouldBeNil)
+		defer func() { So(UpdateModelRatioTiersByJSONString(defaultTiers), ShouldBeNil) }()
+
+		Convey("prices a short prompt at the model ratio", func() {
+			So(GetModelRatioTier("gemini-2.5-pro", 0, 1000), ShouldBeNil)
+		})
+
+		Convey("picks the highest threshold the prompt is above", func() {
+			So(GetModelRatioTier("gemini-2.5-pro", 0, 1001).ModelRatio, ShouldEqual, 0.8)
+			So(GetModelRatioTier("gemini-2.5-pro", 0, 250000).ModelRatio, ShouldEqual, 1.25)
+		})
+
+		Convey("applies to the snapshots of the model", func() {
+			So(GetModelRatioTier("gemini-2.5-pro-preview-06-05", 0, 250000).ModelRatio, ShouldEqual, 1.25)
+			So(GetModelRatioTier("gemini-2.5-flash", 0, 250000), ShouldBeNil)
+		})
+	})
+}
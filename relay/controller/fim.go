@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const fimPlaceholder = "<FILL_ME>"
+
+const fimSystemPrompt = "You are a code completion engine. Reply with only the text that replaces " + fimPlaceholder +
+	" in the user message, without any explanation or markdown code fence."
+
+func isFimSupported(channelType int) bool {
+	switch channelType {
+	case channeltype.Mistral, channeltype.DeepSeek, channeltype.Ollama:
+		return true
+	}
+	return false
+}
+
+// emulateFimRequest turns a fill-in-the-middle request into a chat completion one for the channels
+// that only support chat, the response is in the chat completion format in both cases.
+func emulateFimRequest(textRequest *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) {
+	textRequest.Messages = []relaymodel.Message{
+		{
+			Role:    "system",
+			Content: fimSystemPrompt,
+		},
+		{
+			Role:    "user",
+			Content: conv.AsString(textRequest.Prompt) + fimPlaceholder + textRequest.Suffix,
+		},
+	}
+	textRequest.Prompt = nil
+	textRequest.Suffix = ""
+	meta.Mode = relaymode.ChatCompletions
+	meta.RequestURLPath = "/v1/chat/completions"
+}
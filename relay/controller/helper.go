@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -15,8 +16,12 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
@@ -53,11 +58,94 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model)
 	case relaymode.Moderations:
 		return openai.CountTokenInput(textRequest.Input, textRequest.Model)
+	case relaymode.FimCompletions:
+		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model) + openai.CountTokenText(textRequest.Suffix, textRequest.Model)
 	}
 	return 0
 }
 
-func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64) int64 {
+// CountChatPromptTokens counts the tokens of the messages and the tools of a chat request.
+func CountChatPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest) int {
+	tokens := openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+	if len(textRequest.Tools) > 0 {
+		toolsJson, _ := json.Marshal(textRequest.Tools)
+		tokens += openai.CountTokenText(string(toolsJson), textRequest.Model)
+	}
+	return tokens
+}
+
+// getInboundTextRequest converts a request of the Anthropic, Responses, Gemini or Ollama APIs into
+// the chat request it is relayed as, nil if the request is of another kind or cannot be parsed.
+func getInboundTextRequest(c *gin.Context) *relaymodel.GeneralOpenAIRequest {
+	path := c.Request.URL.Path
+	switch {
+	case path == "/v1/messages":
+		claudeRequest := &anthropic.InboundRequest{}
+		if common.UnmarshalBodyReusable(c, claudeRequest) != nil {
+			return nil
+		}
+		return anthropic.ConvertInboundRequest(claudeRequest)
+	case path == "/v1/responses":
+		responsesRequest := &openai.ResponsesRequest{}
+		if common.UnmarshalBodyReusable(c, responsesRequest) != nil {
+			return nil
+		}
+		var history []relaymodel.Message
+		if responsesRequest.PreviousResponseId != "" {
+			previous, err := model.GetResponseById(responsesRequest.PreviousResponseId, c.GetInt(ctxkey.Id))
+			if err != nil || json.Unmarshal([]byte(previous.Messages), &history) != nil {
+				return nil
+			}
+		}
+		return openai.ConvertResponsesRequest(responsesRequest, history, openai.ConvertResponsesInput(responsesRequest.Input))
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		geminiRequest := &gemini.InboundRequest{}
+		if common.UnmarshalBodyReusable(c, geminiRequest) != nil {
+			return nil
+		}
+		modelName, _, _ := strings.Cut(strings.TrimPrefix(path, "/v1beta/models/"), ":")
+		return gemini.ConvertInboundRequest(modelName, geminiRequest, false)
+	case path == "/api/chat":
+		chatRequest := &ollama.InboundChatRequest{}
+		if common.UnmarshalBodyReusable(c, chatRequest) != nil {
+			return nil
+		}
+		return ollama.ConvertInboundChatRequest(chatRequest)
+	case path == "/api/generate":
+		generateRequest := &ollama.GenerateRequest{}
+		if common.UnmarshalBodyReusable(c, generateRequest) != nil {
+			return nil
+		}
+		return ollama.ConvertInboundGenerateRequest(generateRequest)
+	}
+	return nil
+}
+
+// CountPromptTokens counts the tokens of the prompt of a text request before a channel is picked for
+// it, 0 if the request is of another kind or cannot be parsed. The requests of the other APIs served
+// as chat completions are counted as the chat request they are converted into.
+func CountPromptTokens(c *gin.Context) int {
+	if textRequest := getInboundTextRequest(c); textRequest != nil {
+		return CountChatPromptTokens(textRequest)
+	}
+	relayMode := relaymode.GetByPath(c.Request.URL.Path)
+	switch relayMode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Moderations, relaymode.FimCompletions:
+	default:
+		return 0
+	}
+	textRequest, err := getAndValidateTextRequest(c, relayMode)
+	if err != nil {
+		return 0
+	}
+	return getPromptTokens(textRequest, relayMode)
+}
+
+func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) int64 {
+	// a long prompt may be priced at a tier of its own
+	if tier := billingratio.GetModelRatioTier(textRequest.Model, meta.ChannelType, promptTokens); tier != nil {
+		ratio = tier.ModelRatio * billingratio.GetGroupRatio(meta.Group)
+	}
 	preConsumedTokens := config.PreConsumedQuota + int64(promptTokens)
 	if textRequest.MaxTokens != 0 {
 		preConsumedTokens += int64(textRequest.MaxTokens)
@@ -65,8 +153,21 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 	return int64(float64(preConsumedTokens) * ratio)
 }
 
+// getModelPriceQuota returns the quota of the units, e.g. requests or images, of a model with a fixed
+// price, false if the model is billed by tokens.
+func getModelPriceQuota(modelName string, channelType int, groupRatio float64, units float64) (quota int64, price float64, ok bool) {
+	price, ok = billingratio.GetModelPrice(modelName, channelType)
+	if !ok {
+		return 0, 0, false
+	}
+	return int64(math.Ceil(price * config.QuotaPerUnit * groupRatio * units)), price, true
+}
+
 func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
-	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio, meta)
+	if priceQuota, _, ok := getModelPriceQuota(textRequest.Model, meta.ChannelType, billingratio.GetGroupRatio(meta.Group), 1); ok {
+		preConsumedQuota = priceQuota
+	}
 
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 	if err != nil {
@@ -94,6 +195,43 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	return preConsumedQuota, nil
 }
 
+// weighUsage counts the tokens of the usage as prompt tokens, each kind of token weighed by its
+// ratio, and describes the ratios applied besides those of the model for the log.
+func weighUsage(usage *relaymodel.Usage, modelName string, channelType int, completionRatio float64) (float64, string) {
+	var details strings.Builder
+	weigh := func(tokens int, name string, ratio float64) float64 {
+		if tokens <= 0 {
+			return 0
+		}
+		details.WriteString(fmt.Sprintf("，%s %d × %.2f", name, tokens, ratio))
+		return float64(tokens) * ratio
+	}
+	// the prompt tokens include those read from and written to the cache and those of audio, which
+	// are billed apart. The cached audio tokens are counted in both, they are billed once at both ratios.
+	cachedTokens := usage.GetCachedTokens()
+	cachedAudioTokens := usage.GetCachedAudioTokens()
+	cacheWriteTokens := usage.GetCacheWriteTokens()
+	inputAudioTokens := usage.GetInputAudioTokens() - cachedAudioTokens
+	textTokens := max(usage.PromptTokens-cachedTokens-cacheWriteTokens-inputAudioTokens, 0)
+	cacheReadRatio := billingratio.GetCacheReadRatio(modelName, channelType)
+	audioInputRatio := billingratio.GetModalityRatio(modelName, channelType, billingratio.ModalityAudioInput)
+	promptTokens := float64(textTokens) +
+		weigh(cachedTokens-cachedAudioTokens, "缓存读取", cacheReadRatio) +
+		weigh(cachedAudioTokens, "缓存音频读取", cacheReadRatio*audioInputRatio) +
+		weigh(cacheWriteTokens, "缓存写入", billingratio.GetCacheWriteRatio(modelName, channelType)) +
+		weigh(inputAudioTokens, "音频输入", audioInputRatio)
+	// so do the completion tokens with those of reasoning, audio and images
+	reasoningTokens := usage.GetReasoningTokens()
+	outputAudioTokens := usage.GetOutputAudioTokens()
+	outputImageTokens := usage.GetOutputImageTokens()
+	textTokens = max(usage.CompletionTokens-reasoningTokens-outputAudioTokens-outputImageTokens, 0)
+	completionTokens := float64(textTokens) +
+		weigh(reasoningTokens, "推理", billingratio.GetModalityRatio(modelName, channelType, billingratio.ModalityReasoning)) +
+		weigh(outputAudioTokens, "音频输出", billingratio.GetModalityRatio(modelName, channelType, billingratio.ModalityAudioOutput)) +
+		weigh(outputImageTokens, "图像输出", billingratio.GetModalityRatio(modelName, channelType, billingratio.ModalityImageOutput))
+	return promptTokens + completionTokens*completionRatio, details.String()
+}
+
 func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, systemPromptReset bool) {
 	if usage == nil {
 		logger.Error(ctx, "usage is nil, which is unexpected")
@@ -103,7 +241,17 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	tierContent := ""
+	if tier := billingratio.GetModelRatioTier(textRequest.Model, meta.ChannelType, promptTokens); tier != nil {
+		modelRatio = tier.ModelRatio
+		ratio = modelRatio * groupRatio
+		if tier.CompletionRatio > 0 {
+			completionRatio = tier.CompletionRatio
+		}
+		tierContent = fmt.Sprintf("，阶梯：提示词超过 %d tokens", tier.Threshold)
+	}
+	weightedTokens, ratioDetails := weighUsage(usage, textRequest.Model, meta.ChannelType, completionRatio)
+	quota = int64(math.Ceil(weightedTokens * ratio))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -113,6 +261,12 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
 	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio) + ratioDetails + tierContent
+	if priceQuota, price, ok := getModelPriceQuota(textRequest.Model, meta.ChannelType, groupRatio, 1); ok && totalTokens != 0 {
+		// the model costs the same whatever its tokens, but nothing when nothing was served
+		quota = priceQuota
+		logContent = fmt.Sprintf("模型价格：$%.6f × %.2f", price, groupRatio)
+	}
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
 	if err != nil {
@@ -122,12 +276,17 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
-	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
 		PromptTokens:      promptTokens,
 		CompletionTokens:  completionTokens,
+		CachedTokens:      usage.GetCachedTokens(),
+		CacheWriteTokens:  usage.GetCacheWriteTokens(),
+		InputAudioTokens:  usage.GetInputAudioTokens(),
+		ReasoningTokens:   usage.GetReasoningTokens(),
+		OutputAudioTokens: usage.GetOutputAudioTokens(),
+		OutputImageTokens: usage.GetOutputImageTokens(),
 		ModelName:         textRequest.Model,
 		TokenName:         meta.TokenName,
 		Quota:             int(quota),
@@ -135,20 +294,24 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		IsStream:          meta.IsStream,
 		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
 		SystemPromptReset: systemPromptReset,
+		Hedged:            meta.Hedged,
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
 }
 
-func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
-	if mapping == nil {
-		return modelName, false
-	}
-	mappedModelName := mapping[modelName]
-	if mappedModelName != "" {
-		return mappedModelName, true
+// claimResponse tells whether the response is the one sent to the client. Of a hedged request and
+// its duplicate only the first to succeed is, the other one is neither used nor billed.
+func claimResponse(c *gin.Context) bool {
+	claim, ok := c.Get(ctxkey.HedgeClaim)
+	if !ok || claim == nil {
+		return true
 	}
-	return modelName, false
+	return claim.(func() bool)()
+}
+
+func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
+	return model.MapModelName(modelName, mapping)
 }
 
 func isErrorHappened(meta *meta.Meta, resp *http.Response) bool {
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestWeighUsage(t *testing.T) {
+	Convey("weighUsage", t, func() {
+		cases := []struct {
+			name            string
+			model           string
+			completionRatio float64
+			usage           relaymodel.Usage
+			expected        float64
+		}{
+			{
+				name:            "bills the text tokens at the completion ratio",
+				model:           "gpt-4o",
+				completionRatio: 4,
+				usage:           relaymodel.Usage{PromptTokens: 100, CompletionTokens: 50},
+				expected:        100 + 50*4,
+			},
+			{
+				name:     "discounts the cached prompt tokens",
+				model:    "gpt-4o",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptTokensDetails: &relaymodel.PromptTokensDetails{CachedTokens: 60}},
+				expected: 40 + 60*0.5,
+			},
+			{
+				name:     "reads the cache hits of DeepSeek",
+				model:    "deepseek-chat",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptCacheHitTokens: 80},
+				expected: 20 + 80*0.1,
+			},
+			{
+				name:     "charges the cache writes",
+				model:    "claude-3-5-sonnet-20241022",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptTokensDetails: &relaymodel.PromptTokensDetails{CachedTokens: 50, CacheWriteTokens: 40}},
+				expected: 10 + 50*0.1 + 40*1.25,
+			},
+			{
+				name:     "bills the input audio at its ratio",
+				model:    "gpt-4o-audio-preview",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptTokensDetails: &relaymodel.PromptTokensDetails{AudioTokens: 50}},
+				expected: 50 + 50*16,
+			},
+			{
+				name:     "bills the cached audio once when the totals imply it",
+				model:    "gpt-4o-realtime-preview",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptTokensDetails: &relaymodel.PromptTokensDetails{CachedTokens: 64, AudioTokens: 80}},
+				expected: 20*0.5 + 44*0.5*8 + 36*8,
+			},
+			{
+				name:     "bills the cached audio once when the upstream tells it",
+				model:    "gpt-4o-realtime-preview",
+				usage:    relaymodel.Usage{PromptTokens: 100, PromptTokensDetails: &relaymodel.PromptTokensDetails{CachedTokens: 64, AudioTokens: 80, CachedAudioTokens: 50}},
+				expected: 6 + 14*0.5 + 50*0.5*8 + 30*8,
+			},
+			{
+				name:            "bills the reasoning tokens as completion",
+				model:           "o3",
+				completionRatio: 4,
+				usage:           relaymodel.Usage{CompletionTokens: 100, CompletionTokensDetails: &relaymodel.CompletionTokensDetails{ReasoningTokens: 80}},
+				expected:        (20 + 80) * 4,
+			},
+			{
+				name:            "bills the output audio at its ratio",
+				model:           "gpt-4o-audio-preview",
+				completionRatio: 4,
+				usage:           relaymodel.Usage{CompletionTokens: 100, CompletionTokensDetails: &relaymodel.CompletionTokensDetails{AudioTokens: 60}},
+				expected:        (40 + 60*8) * 4,
+			},
+			{
+				name:            "bills the output images at their ratio",
+				model:           "gemini-2.5-flash-image",
+				completionRatio: 1,
+				usage:           relaymodel.Usage{CompletionTokens: 1300, CompletionTokensDetails: &relaymodel.CompletionTokensDetails{ImageTokens: 1290}},
+				expected:        10 + 1290*12,
+			},
+		}
+		for _, tc := range cases {
+			Convey(tc.name, func() {
+				weighted, _ := weighUsage(&tc.usage, tc.model, 0, tc.completionRatio)
+				So(weighted, ShouldAlmostEqual, tc.expected)
+			})
+		}
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -21,14 +23,18 @@ import (
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
 	err := common.UnmarshalBodyReusable(c, imageRequest)
 	if err != nil {
 		return nil, err
 	}
+	if relayMode != relaymode.ImagesGenerations && imageRequest.Image == nil {
+		return nil, errors.New("image is required")
+	}
 	if imageRequest.N == 0 {
 		imageRequest.N = 1
 	}
@@ -66,9 +72,9 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
-	// check prompt length
-	if imageRequest.Prompt == "" {
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	// check prompt length, variations come without prompt
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
@@ -103,6 +109,60 @@ func getImageCostRatio(imageRequest *relaymodel.ImageRequest) (float64, error) {
 	return imageCostRatio, nil
 }
 
+// getMultipartImageRequestBody rebuilds the multipart body of image edits and variations with the mapped model,
+// the original boundary is kept so that the Content-Type header stays valid for retries.
+func getMultipartImageRequestBody(c *gin.Context, imageRequest *relaymodel.ImageRequest) (io.Reader, error) {
+	form := c.Request.MultipartForm
+	if form == nil {
+		return nil, errors.New("multipart form not found")
+	}
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	err = writer.SetBoundary(params["boundary"])
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range form.Value {
+		if key == "model" {
+			continue
+		}
+		for _, value := range values {
+			if err = writer.WriteField(key, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = writer.WriteField("model", imageRequest.Model); err != nil {
+		return nil, err
+	}
+	for _, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			part, err := writer.CreatePart(fileHeader.Header)
+			if err != nil {
+				return nil, err
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(part, file)
+			_ = file.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
 func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 	meta := meta.GetByContext(c)
@@ -135,7 +195,16 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
-	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
+	if imageRequest.Image != nil {
+		if isModelMapped {
+			requestBody, err = getMultipartImageRequestBody(c, imageRequest)
+			if err != nil {
+				return openai.ErrorWrapper(err, "rebuild_image_request_failed", http.StatusInternalServerError)
+			}
+		} else {
+			requestBody = c.Request.Body
+		}
+	} else if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
 		jsonStr, err := json.Marshal(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
@@ -157,6 +226,9 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		channeltype.Ali,
 		channeltype.Replicate,
 		channeltype.Baidu:
+		if relayMode != relaymode.ImagesGenerations {
+			return openai.ErrorWrapper(errors.New("image edits and variations are not supported by this channel"), "image_edit_not_supported", http.StatusBadRequest)
+		}
 		finalRequest, err := adaptor.ConvertImageRequest(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusInternalServerError)
@@ -174,13 +246,20 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
 	var quota int64
+	images := imageRequest.N
 	switch meta.ChannelType {
 	case channeltype.Replicate:
 		// replicate always return 1 image
+		images = 1
 		quota = int64(ratio * imageCostRatio * 1000)
 	default:
 		quota = int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
 	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+	if priceQuota, price, ok := getModelPriceQuota(imageModel, meta.ChannelType, groupRatio, float64(images)); ok {
+		quota = priceQuota
+		logContent = fmt.Sprintf("模型价格：$%.6f × %d 张 × %.2f", price, images, groupRatio)
+	}
 
 	if userQuota-quota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
@@ -210,7 +289,6 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 		if quota != 0 {
 			tokenName := c.GetString(ctxkey.TokenName)
-			logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
 			model.RecordConsumeLog(ctx, &model.Log{
 				UserId:           meta.UserId,
 				ChannelId:        meta.ChannelId,
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// InboundConverter translates the OpenAI chat completion output produced by the relay
+// pipeline into the wire format of the API that the client actually called.
+type InboundConverter interface {
+	// ConvertResponse converts a complete, non-stream response body.
+	ConvertResponse(body []byte) ([]byte, error)
+	// ConvertStreamData converts the payload of a single "data:" line of an OpenAI stream.
+	ConvertStreamData(data string) []byte
+	// FinishStream returns the bytes to be sent once the upstream stream has ended.
+	FinishStream(usage *model.Usage) []byte
+	// ConvertError converts an OpenAI style error body.
+	ConvertError(statusCode int, body []byte) []byte
+	ContentType(stream bool) string
+}
+
+// InboundWriter wraps the gin response writer so that adaptors keep writing OpenAI
+// responses while the client receives them in its own format.
+// Non-stream and error responses are buffered until Finish is called.
+type InboundWriter struct {
+	gin.ResponseWriter
+	converter  InboundConverter
+	statusCode int
+	body       bytes.Buffer
+	pending    []byte
+	streaming  bool
+	written    bool
+}
+
+func NewInboundWriter(writer gin.ResponseWriter, converter InboundConverter) *InboundWriter {
+	return &InboundWriter{
+		ResponseWriter: writer,
+		converter:      converter,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *InboundWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.statusCode = code
+	}
+}
+
+func (w *InboundWriter) WriteHeaderNow() {}
+
+func (w *InboundWriter) Status() int {
+	return w.statusCode
+}
+
+func (w *InboundWriter) Written() bool {
+	return w.written
+}
+
+func (w *InboundWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *InboundWriter) Write(data []byte) (int, error) {
+	w.written = true
+	if w.statusCode >= http.StatusBadRequest {
+		return w.body.Write(data)
+	}
+	if !w.streaming && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		w.Header().Set("Content-Type", w.converter.ContentType(true))
+		w.Header().Del("Content-Length")
+	}
+	if !w.streaming {
+		return w.body.Write(data)
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.pending[:idx]))
+		w.pending = w.pending[idx+1:]
+		if err := w.writeStreamLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *InboundWriter) writeStreamLine(line string) error {
+	if !strings.HasPrefix(line, "data:") {
+		return nil
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return nil
+	}
+	converted := w.converter.ConvertStreamData(data)
+	if len(converted) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(converted)
+	return err
+}
+
+func (w *InboundWriter) Flush() {
+	// flushing a buffered response would send the headers too early
+	if w.streaming {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Finish sends whatever has been held back, it must be called after the relay is done.
+func (w *InboundWriter) Finish(usage *model.Usage) {
+	if w.streaming {
+		if len(w.pending) > 0 {
+			_ = w.writeStreamLine(strings.TrimSpace(string(w.pending)))
+			w.pending = nil
+		}
+		_, _ = w.ResponseWriter.Write(w.converter.FinishStream(usage))
+		w.ResponseWriter.Flush()
+		return
+	}
+	if !w.written {
+		return
+	}
+	body := w.body.Bytes()
+	if w.statusCode >= http.StatusBadRequest {
+		body = w.converter.ConvertError(w.statusCode, body)
+	} else if converted, err := w.converter.ConvertResponse(body); err == nil {
+		body = converted
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", w.converter.ContentType(false))
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(body)
+}
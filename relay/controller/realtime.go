@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+var realtimeUpgrader = websocket.Upgrader{
+	// the token is checked instead of the origin, browsers send it as a subprotocol
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{"realtime"},
+}
+
+// realtimeSession bridges a client WebSocket to the upstream one and meters the usage
+// reported by every response.done event.
+type realtimeSession struct {
+	ctx        context.Context
+	meta       *meta.Meta
+	modelRatio float64
+	groupRatio float64
+	client     *websocket.Conn
+	upstream   *websocket.Conn
+	closeOnce  sync.Once
+}
+
+func RelayRealtimeHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("websocket upgrade is required"), "invalid_realtime_request", http.StatusBadRequest)
+	}
+	modelName := c.Query("model")
+	if modelName == "" {
+		return openai.ErrorWrapper(errors.New("model is required"), "invalid_realtime_request", http.StatusBadRequest)
+	}
+	if meta.APIType != apitype.OpenAI {
+		return openai.ErrorWrapper(fmt.Errorf("realtime is not supported by channel type %d", meta.ChannelType), "realtime_not_supported", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = modelName
+	meta.ActualModelName, _ = getMappedModelName(modelName, meta.ModelMapping)
+	meta.IsStream = true
+
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	adaptor.Init(meta)
+	fullRequestURL, err := adaptor.GetRequestURL(meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+	req, err := http.NewRequest(http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	err = adaptor.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	header := http.Header{}
+	for _, key := range []string{"Authorization", "api-key", "HTTP-Referer", "X-Title"} {
+		if value := req.Header.Get(key); value != "" {
+			header.Set(key, value)
+		}
+	}
+	header.Set("OpenAI-Beta", "realtime=v1")
+
+	upstream, resp, err := websocket.DefaultDialer.DialContext(ctx, fullRequestURL, header)
+	if err != nil {
+		logger.Errorf(ctx, "dial realtime upstream failed: %s", err.Error())
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return RelayErrorHandler(resp)
+		}
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already replied to the client
+		logger.Errorf(ctx, "upgrade realtime connection failed: %s", err.Error())
+		_ = upstream.Close()
+		return nil
+	}
+
+	session := &realtimeSession{
+		ctx:        ctx,
+		meta:       meta,
+		modelRatio: billingratio.GetModelRatio(meta.ActualModelName, meta.ChannelType),
+		groupRatio: billingratio.GetGroupRatio(meta.Group),
+		client:     client,
+		upstream:   upstream,
+	}
+	go session.forwardClientMessages()
+	session.forwardUpstreamMessages()
+	return nil
+}
+
+func (s *realtimeSession) close() {
+	s.closeOnce.Do(func() {
+		_ = s.client.Close()
+		_ = s.upstream.Close()
+	})
+}
+
+func (s *realtimeSession) forwardClientMessages() {
+	defer s.close()
+	for {
+		messageType, data, err := s.client.ReadMessage()
+		if err != nil {
+			return
+		}
+		err = s.upstream.WriteMessage(messageType, data)
+		if err != nil {
+			logger.Errorf(s.ctx, "write realtime upstream failed: %s", err.Error())
+			return
+		}
+	}
+}
+
+func (s *realtimeSession) forwardUpstreamMessages() {
+	defer s.close()
+	for {
+		messageType, data, err := s.upstream.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				_ = s.client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeErr.Code, closeErr.Text))
+			}
+			return
+		}
+		err = s.client.WriteMessage(messageType, data)
+		if err != nil {
+			return
+		}
+		if messageType != websocket.TextMessage || !bytes.Contains(data, []byte(`"response.done"`)) {
+			continue
+		}
+		var event openai.RealtimeEvent
+		if err = json.Unmarshal(data, &event); err != nil || event.Type != "response.done" {
+			continue
+		}
+		if event.Response == nil || event.Response.Usage == nil {
+			continue
+		}
+		if s.consumeQuota(event.Response.Usage) {
+			continue
+		}
+		// the quota is used up, end the session like the upstream would do on a fatal error
+		data, _ = json.Marshal(openai.RealtimeEvent{
+			EventId: "event_" + random.GetUUID(),
+			Type:    "error",
+			Error: &openai.RealtimeError{
+				Type:    "insufficient_quota",
+				Code:    "insufficient_user_quota",
+				Message: "user quota is not enough",
+			},
+		})
+		_ = s.client.WriteMessage(websocket.TextMessage, data)
+		_ = s.client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "insufficient quota"))
+		return
+	}
+}
+
+// consumeQuota deducts the quota of a single response and reports whether the session may go on.
+func (s *realtimeSession) consumeQuota(usage *openai.RealtimeUsage) bool {
+	meta := s.meta
+	ratio := s.modelRatio * s.groupRatio
+	completionRatio := billingratio.GetCompletionRatio(meta.ActualModelName, meta.ChannelType)
+	tokenUsage := &relaymodel.Usage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		PromptTokensDetails: &relaymodel.PromptTokensDetails{
+			CachedTokens:      usage.InputTokenDetails.CachedTokens,
+			AudioTokens:       usage.InputTokenDetails.AudioTokens,
+			CachedAudioTokens: usage.InputTokenDetails.CachedTokensDetails.AudioTokens,
+		},
+		CompletionTokensDetails: &relaymodel.CompletionTokensDetails{
+			AudioTokens: usage.OutputTokenDetails.AudioTokens,
+		},
+	}
+	weightedTokens, ratioDetails := weighUsage(tokenUsage, meta.ActualModelName, meta.ChannelType, completionRatio)
+	quota := int64(math.Ceil(weightedTokens * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		logger.Error(s.ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(s.ctx, meta.UserId)
+	if err != nil {
+		logger.Error(s.ctx, "error update user quota cache: "+err.Error())
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", s.modelRatio, s.groupRatio, completionRatio) + ratioDetails
+	model.RecordConsumeLog(s.ctx, &model.Log{
+		UserId:            meta.UserId,
+		ChannelId:         meta.ChannelId,
+		PromptTokens:      usage.InputTokens,
+		CompletionTokens:  usage.OutputTokens,
+		CachedTokens:      tokenUsage.GetCachedTokens(),
+		InputAudioTokens:  tokenUsage.GetInputAudioTokens(),
+		OutputAudioTokens: tokenUsage.GetOutputAudioTokens(),
+		ModelName:         meta.ActualModelName,
+		TokenName:         meta.TokenName,
+		Quota:             int(quota),
+		Content:           logContent,
+		IsStream:          true,
+		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+
+	userQuota, err := model.CacheGetUserQuota(s.ctx, meta.UserId)
+	if err == nil && userQuota <= 0 {
+		return false
+	}
+	token, err := model.GetTokenById(meta.TokenId)
+	if err == nil && !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func getRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	if rerankRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if rerankRequest.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return nil, errors.New("documents is required")
+	}
+	if rerankRequest.TopN < 0 {
+		return nil, errors.New("top_n must not be negative")
+	}
+	return rerankRequest, nil
+}
+
+func getRerankPromptTokens(rerankRequest *relaymodel.RerankRequest) int {
+	// every document is scored against the query
+	queryTokens := openai.CountTokenText(rerankRequest.Query, rerankRequest.Model)
+	promptTokens := 0
+	for _, text := range rerankRequest.DocumentTexts() {
+		promptTokens += queryTokens + openai.CountTokenText(text, rerankRequest.Model)
+	}
+	return promptTokens
+}
+
+func RelayRerankHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest, err := getRerankRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getRerankRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, _ = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+	meta.PromptTokens = getRerankPromptTokens(rerankRequest)
+
+	modelRatio := billingratio.GetModelRatio(rerankRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-int64(float64(meta.PromptTokens)*ratio) < 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(fmt.Errorf("rerank is not supported by channel %s", a.GetChannelName()), "rerank_not_supported", http.StatusBadRequest)
+	}
+	a.Init(meta)
+
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(rerankRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_rerank_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_rerank_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := a.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	respErr, rerankResponse := openai.RerankHandler(resp)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
+	}
+	promptTokens := openai.RerankUsage(rerankResponse)
+	if promptTokens == 0 {
+		promptTokens = meta.PromptTokens
+	}
+	usage := &relaymodel.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	rerankResponse.Usage = usage
+	c.Set(ctxkey.Usage, usage)
+	c.JSON(http.StatusOK, rerankResponse)
+
+	// upstreams such as Cohere bill by search units, which are counted as 1K tokens each
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+	billedTokens := float64(promptTokens)
+	if searchUnits := openai.RerankSearchUnits(rerankResponse); searchUnits > 0 {
+		billedTokens = float64(searchUnits) * 1000
+		logContent += fmt.Sprintf("，搜索单元：%d", searchUnits)
+	}
+	quota := int64(math.Ceil(billedTokens * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	if priceQuota, price, ok := getModelPriceQuota(rerankRequest.Model, meta.ChannelType, groupRatio, 1); ok {
+		quota = priceQuota
+		logContent = fmt.Sprintf("模型价格：$%.6f × %.2f", price, groupRatio)
+	}
+	go postConsumeRerankQuota(ctx, meta, rerankRequest, usage, quota, logContent)
+	return nil
+}
+
+func postConsumeRerankQuota(ctx context.Context, meta *meta.Meta, rerankRequest *relaymodel.RerankRequest, usage *relaymodel.Usage, quota int64, logContent string) {
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:       meta.UserId,
+		ChannelId:    meta.ChannelId,
+		PromptTokens: usage.PromptTokens,
+		ModelName:    rerankRequest.Model,
+		TokenName:    meta.TokenName,
+		Quota:        int(quota),
+		Content:      logContent,
+		ElapsedTime:  helper.CalcElapsedTime(meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+}
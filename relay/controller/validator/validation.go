@@ -19,6 +19,10 @@ func ValidateTextRequest(textRequest *model.GeneralOpenAIRequest, relayMode int)
 		if textRequest.Prompt == "" {
 			return errors.New("field prompt is required")
 		}
+	case relaymode.FimCompletions:
+		if textRequest.Prompt == nil || textRequest.Prompt == "" {
+			return errors.New("field prompt is required")
+		}
 	case relaymode.ChatCompletions:
 		if textRequest.Messages == nil || len(textRequest.Messages) == 0 {
 			return errors.New("field messages is required")
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func getVideoRequest(c *gin.Context) (*relaymodel.VideoRequest, error) {
+	videoRequest := &relaymodel.VideoRequest{}
+	err := common.UnmarshalBodyReusable(c, videoRequest)
+	if err != nil {
+		return nil, err
+	}
+	if videoRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if videoRequest.Prompt == "" && videoRequest.ImageURL == "" {
+		return nil, errors.New("prompt is required")
+	}
+	if videoRequest.Seconds != "" {
+		if seconds, err := videoRequest.Seconds.Int64(); err != nil || seconds <= 0 {
+			return nil, errors.New("seconds must be a positive integer")
+		}
+	}
+	return videoRequest, nil
+}
+
+// VideoObject converts a stored task into the video object of the videos API.
+func VideoObject(task *model.VideoTask) relaymodel.Video {
+	video := relaymodel.Video{
+		Id:        task.Id,
+		Object:    "video",
+		Model:     task.Model,
+		Status:    task.Status,
+		Progress:  task.Progress,
+		CreatedAt: task.CreatedAt,
+		Seconds:   strconv.Itoa(task.Seconds),
+		Size:      task.Size,
+		Prompt:    task.Prompt,
+		VideoURL:  task.VideoUrl,
+	}
+	if task.CompletedAt != 0 {
+		completedAt := task.CompletedAt
+		video.CompletedAt = &completedAt
+	}
+	if task.Error != "" {
+		video.Error = &relaymodel.VideoError{
+			Code:    "video_generation_failed",
+			Message: task.Error,
+		}
+	}
+	return video
+}
+
+// RelayVideoHelper creates an upstream video task. Its whole price is pre-consumed here, then the
+// video task worker charges it once the task succeeds or returns it if the task fails.
+func RelayVideoHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	videoRequest, err := getVideoRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getVideoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = videoRequest.Model
+	videoRequest.Model, _ = getMappedModelName(videoRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = videoRequest.Model
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	videoAdaptor, ok := a.(adaptor.VideoAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(fmt.Errorf("video generation is not supported by channel %s", a.GetChannelName()), "video_not_supported", http.StatusBadRequest)
+	}
+	a.Init(meta)
+
+	// video models are priced per second of the generated video
+	seconds := videoRequest.GetSeconds()
+	modelRatio := billingratio.GetModelRatio(videoRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	quota := int64(math.Ceil(ratio * 1000 * float64(seconds)))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	priceQuota, price, fixedPrice := getModelPriceQuota(videoRequest.Model, meta.ChannelType, groupRatio, float64(seconds))
+	if fixedPrice {
+		quota = priceQuota
+	}
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-quota < 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	if quota > 0 {
+		err = model.PreConsumeTokenQuota(meta.TokenId, quota)
+		if err != nil {
+			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		}
+		err = model.CacheDecreaseUserQuota(meta.UserId, quota)
+		if err != nil {
+			logger.Error(ctx, "decrease_user_quota_failed: "+err.Error())
+		}
+	}
+
+	upstreamTask, bizErr := createVideoTask(c, meta, a, videoAdaptor, videoRequest)
+	if bizErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, quota, meta.TokenId)
+		return bizErr
+	}
+
+	now := helper.GetTimestamp()
+	task := &model.VideoTask{
+		Id:             "video_" + random.GetUUID(),
+		UserId:         meta.UserId,
+		TokenId:        meta.TokenId,
+		TokenName:      meta.TokenName,
+		ChannelId:      meta.ChannelId,
+		KeyHash:        model.HashChannelKey(meta.APIKey),
+		Model:          meta.OriginModelName,
+		ActualModel:    meta.ActualModelName,
+		UpstreamTaskId: upstreamTask.Id,
+		Status:         upstreamTask.Status,
+		Prompt:         videoRequest.Prompt,
+		Seconds:        seconds,
+		Size:           videoRequest.Size,
+		Quota:          quota,
+		ModelRatio:     modelRatio,
+		GroupRatio:     groupRatio,
+		ModelPrice:     price,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	err = task.Insert()
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, quota, meta.TokenId)
+		return openai.ErrorWrapper(err, "insert_video_task_failed", http.StatusInternalServerError)
+	}
+	c.JSON(http.StatusOK, VideoObject(task))
+	return nil
+}
+
+func createVideoTask(c *gin.Context, meta *meta.Meta, a adaptor.Adaptor, videoAdaptor adaptor.VideoAdaptor, videoRequest *relaymodel.VideoRequest) (*relaymodel.VideoTask, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	convertedRequest, err := videoAdaptor.ConvertVideoRequest(videoRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_video_request_failed", http.StatusBadRequest)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_video_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := a.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return nil, RelayErrorHandler(resp)
+	}
+
+	// do response
+	upstreamTask, err := videoAdaptor.ParseVideoTask(resp)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "parse_video_task_failed", http.StatusInternalServerError)
+	}
+	if upstreamTask.Id == "" {
+		return nil, openai.ErrorWrapper(errors.New("upstream returned no task id"), "parse_video_task_failed", http.StatusInternalServerError)
+	}
+	if upstreamTask.Status == relaymodel.VideoStatusFailed {
+		return nil, openai.ErrorWrapper(errors.New(upstreamTask.Error), "video_generation_failed", http.StatusInternalServerError)
+	}
+	return upstreamTask, nil
+}
@@ -35,6 +35,8 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// Hedged is set when a duplicate of the request was sent to another channel
+	Hedged bool
 }
 
 func GetByContext(c *gin.Context) *Meta {
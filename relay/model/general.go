@@ -63,6 +63,8 @@ type GeneralOpenAIRequest struct {
 	Quality *string `json:"quality,omitempty"`
 	Size    string  `json:"size,omitempty"`
 	Style   *string `json:"style,omitempty"`
+	// https://docs.mistral.ai/api/#tag/fim
+	Suffix string `json:"suffix,omitempty"`
 	// Others
 	Instruction string `json:"instruction,omitempty"`
 	NumCtx      int    `json:"num_ctx,omitempty"`
@@ -5,11 +5,101 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
 	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	// DeepSeek reports the cached prompt tokens in its own field
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens,omitempty"`
 }
 
+// PromptTokensDetails splits the prompt tokens, which include the cached and the audio ones.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	AudioTokens  int `json:"audio_tokens,omitempty"`
+	// CacheWriteTokens are the prompt tokens written to the cache, only some upstreams charge for them
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+	// CachedAudioTokens are the audio tokens among the cached ones, only the realtime API tells them
+	CachedAudioTokens int `json:"-"`
+}
+
+// GetCachedTokens returns the prompt tokens read from the cache of the upstream.
+func (u *Usage) GetCachedTokens() int {
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		return u.PromptTokensDetails.CachedTokens
+	}
+	return u.PromptCacheHitTokens
+}
+
+// GetCacheWriteTokens returns the prompt tokens written to the cache of the upstream.
+func (u *Usage) GetCacheWriteTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CacheWriteTokens
+}
+
+// GetInputAudioTokens returns the prompt tokens of audio.
+func (u *Usage) GetInputAudioTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.AudioTokens
+}
+
+// GetCachedAudioTokens returns the audio tokens read from the cache, which are counted both as cached
+// and as audio tokens. Unless the upstream tells them, they are the overlap the totals imply.
+func (u *Usage) GetCachedAudioTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	cachedTokens, audioTokens := u.GetCachedTokens(), u.PromptTokensDetails.AudioTokens
+	if u.PromptTokensDetails.CachedAudioTokens > 0 {
+		return min(u.PromptTokensDetails.CachedAudioTokens, cachedTokens, audioTokens)
+	}
+	overlap := cachedTokens + u.GetCacheWriteTokens() + audioTokens - u.PromptTokens
+	return max(min(overlap, cachedTokens, audioTokens), 0)
+}
+
+// GetReasoningTokens returns the completion tokens spent on reasoning.
+func (u *Usage) GetReasoningTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
+}
+
+// GetOutputAudioTokens returns the completion tokens of audio.
+func (u *Usage) GetOutputAudioTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.AudioTokens
+}
+
+// GetOutputImageTokens returns the completion tokens of images.
+func (u *Usage) GetOutputImageTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ImageTokens
+}
+
+// SetCacheTokens records the prompt tokens read from and written to the cache of the upstream.
+func (u *Usage) SetCacheTokens(cachedTokens int, cacheWriteTokens int) {
+	if cachedTokens == 0 && cacheWriteTokens == 0 {
+		return
+	}
+	if u.PromptTokensDetails == nil {
+		u.PromptTokensDetails = &PromptTokensDetails{}
+	}
+	u.PromptTokensDetails.CachedTokens = cachedTokens
+	u.PromptTokensDetails.CacheWriteTokens = cacheWriteTokens
+}
+
+// CompletionTokensDetails splits the completion tokens, which include the reasoning, audio and image ones.
 type CompletionTokensDetails struct {
 	ReasoningTokens          int `json:"reasoning_tokens"`
+	AudioTokens              int `json:"audio_tokens,omitempty"`
+	ImageTokens              int `json:"image_tokens,omitempty"`
 	AcceptedPredictionTokens int `json:"accepted_prediction_tokens"`
 	RejectedPredictionTokens int `json:"rejected_prediction_tokens"`
 }
@@ -0,0 +1,59 @@
+package model
+
+import "encoding/json"
+
+type RerankRequest struct {
+	Model           string           `json:"model"`
+	Query           string           `json:"query"`
+	Documents       []RerankDocument `json:"documents"`
+	TopN            int              `json:"top_n,omitempty"`
+	ReturnDocuments *bool            `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int              `json:"max_chunks_per_doc,omitempty"`
+}
+
+// RerankDocument accepts both a plain string and an object with a text field.
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+func (d *RerankDocument) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		d.Text = text
+		return nil
+	}
+	type document RerankDocument
+	return json.Unmarshal(data, (*document)(d))
+}
+
+func (r RerankRequest) DocumentTexts() []string {
+	texts := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		texts = append(texts, document.Text)
+	}
+	return texts
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankBilledUnits struct {
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+	SearchUnits  int `json:"search_units,omitempty"`
+}
+
+type RerankMeta struct {
+	BilledUnits *RerankBilledUnits `json:"billed_units,omitempty"`
+	Tokens      *RerankBilledUnits `json:"tokens,omitempty"`
+}
+
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Results []RerankResult `json:"results"`
+	Meta    *RerankMeta    `json:"meta,omitempty"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
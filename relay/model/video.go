@@ -0,0 +1,60 @@
+package model
+
+import "encoding/json"
+
+const (
+	VideoStatusQueued     = "queued"
+	VideoStatusInProgress = "in_progress"
+	VideoStatusCompleted  = "completed"
+	VideoStatusFailed     = "failed"
+)
+
+// DefaultVideoSeconds is the duration billed when the request does not set one.
+const DefaultVideoSeconds = 5
+
+// VideoRequest is the request of POST /v1/videos, it follows the OpenAI video API
+// with an extra image_url for image-to-video models.
+type VideoRequest struct {
+	Model    string      `json:"model"`
+	Prompt   string      `json:"prompt"`
+	Seconds  json.Number `json:"seconds,omitempty"`
+	Size     string      `json:"size,omitempty"`
+	ImageURL string      `json:"image_url,omitempty"`
+}
+
+func (r *VideoRequest) GetSeconds() int {
+	seconds, err := r.Seconds.Int64()
+	if err != nil || seconds <= 0 {
+		return DefaultVideoSeconds
+	}
+	return int(seconds)
+}
+
+// VideoTask is the state of an upstream video generation task.
+type VideoTask struct {
+	Id       string
+	Status   string
+	Progress int
+	VideoURL string
+	Error    string
+}
+
+type VideoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Video struct {
+	Id          string      `json:"id"`
+	Object      string      `json:"object"`
+	Model       string      `json:"model"`
+	Status      string      `json:"status"`
+	Progress    int         `json:"progress"`
+	CreatedAt   int64       `json:"created_at"`
+	CompletedAt *int64      `json:"completed_at"`
+	Seconds     string      `json:"seconds"`
+	Size        string      `json:"size,omitempty"`
+	Prompt      string      `json:"prompt"`
+	VideoURL    string      `json:"video_url,omitempty"`
+	Error       *VideoError `json:"error"`
+}
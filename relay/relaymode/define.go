@@ -13,4 +13,10 @@ const (
 	AudioTranslation
 	// Proxy is a special relay mode for proxying requests to custom upstream
 	Proxy
+	ImagesEdits
+	ImagesVariations
+	Rerank
+	Realtime
+	FimCompletions
+	Videos
 )
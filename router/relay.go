@@ -17,26 +17,80 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	// https://docs.anthropic.com/en/api/messages
+	messagesRouter := router.Group("/v1/messages")
+	messagesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		messagesRouter.POST("", middleware.Distribute(), controller.RelayAnthropicMessages)
+		messagesRouter.POST("/count_tokens", controller.CountAnthropicTokens)
+	}
+	// https://platform.openai.com/docs/api-reference/responses
+	responsesRouter := router.Group("/v1/responses")
+	responsesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		responsesRouter.POST("", middleware.Distribute(), controller.RelayResponses)
+		responsesRouter.GET("/:id", controller.GetResponse)
+		responsesRouter.DELETE("/:id", controller.DeleteResponse)
+	}
+	// https://ai.google.dev/api/generate-content
+	geminiRouter := router.Group("/v1beta/models")
+	geminiRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		// gin cannot route on the method after the colon, countTokens is answered before the distributor
+		geminiRouter.POST("/:action", controller.CountGeminiTokens, middleware.Distribute(), controller.RelayGeminiNative)
+	}
+	// https://github.com/ollama/ollama/blob/main/docs/api.md
+	ollamaRouter := router.Group("/api")
+	ollamaRouter.Use(middleware.RelayPanicRecover(), middleware.JSONContentType(), middleware.TokenAuth())
+	{
+		ollamaRouter.GET("/tags", controller.ListOllamaTags)
+		ollamaRouter.POST("/chat", middleware.Distribute(), controller.RelayOllamaChat)
+		ollamaRouter.POST("/generate", middleware.Distribute(), controller.RelayOllamaGenerate)
+		ollamaRouter.POST("/embed", middleware.Distribute(), controller.RelayOllamaEmbed)
+	}
+	// https://platform.openai.com/docs/api-reference/files
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("/:id", controller.GetFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.GetFileContent)
+	}
+	// https://platform.openai.com/docs/api-reference/batch
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("/:id", controller.GetBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
+	// https://platform.openai.com/docs/api-reference/videos
+	videosRouter := router.Group("/v1/videos")
+	videosRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		videosRouter.GET("", controller.ListVideos)
+		videosRouter.POST("", middleware.Distribute(), controller.Relay)
+		videosRouter.GET("/:id", controller.GetVideo)
+	}
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
 	{
 		relayV1Router.Any("/oneapi/proxy/:channelid/*target", controller.Relay)
 		relayV1Router.POST("/completions", controller.Relay)
+		relayV1Router.POST("/fim/completions", controller.Relay)
 		relayV1Router.POST("/chat/completions", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
@@ -44,6 +98,8 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.GET("/fine_tuning/jobs/:id/events", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/models/:model", controller.RelayNotImplemented)
 		relayV1Router.POST("/moderations", controller.Relay)
+		relayV1Router.POST("/rerank", controller.Relay)
+		relayV1Router.GET("/realtime", controller.Relay)
 		relayV1Router.POST("/assistants", controller.RelayNotImplemented)
 		relayV1Router.GET("/assistants/:id", controller.RelayNotImplemented)
 		relayV1Router.POST("/assistants/:id", controller.RelayNotImplemented)